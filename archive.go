@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/nahuakang/gophotos/backup"
+	"github.com/nahuakang/gophotos/logger"
+	"github.com/nahuakang/gophotos/models"
+)
+
+// backupArchive runs the backup command
+func backupArchive(args []string, lg *logger.Logger) error {
+	fs := newFlagSet("backup", "backup [-o FILE] [flags]")
+	out := fs.String("o", "", `archive to write, or "-" for stdout (default gophotos-<time>.tar.gz)`)
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	schema, err := schemaVersion(services)
+	if err != nil {
+		return err
+	}
+	dump, err := services.Dump()
+	if err != nil {
+		return err
+	}
+	manifest := backup.Manifest{
+		CreatedAt:     time.Now().UTC(),
+		AppVersion:    appVersion(),
+		SchemaVersion: schema,
+	}
+
+	path := *out
+	switch path {
+	case "-":
+		path = "stdout"
+		err = backup.Write(os.Stdout, dump, manifest)
+	case "":
+		path = "gophotos-" + manifest.CreatedAt.Format("20060102-150405") + ".tar.gz"
+		fallthrough
+	default:
+		err = writeFileAtomic(path, func(w io.Writer) error {
+			return backup.Write(w, dump, manifest)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	// Backups piped elsewhere are audited too: they hold every
+	// password hash just the same
+	cliAudit(services, models.AuditEntry{
+		Action:     models.AuditSystemBackup,
+		TargetType: models.AuditTargetSystem,
+		Note:       filepath.Base(path),
+	})
+	fmt.Fprintf(os.Stderr, "wrote %s: %d users, %d galleries, %d audit entries\n",
+		path, len(dump.Users), len(dump.Galleries), len(dump.AuditEntries))
+	return nil
+}
+
+// restoreArchive runs the restore command
+func restoreArchive(args []string, lg *logger.Logger) error {
+	fs := newFlagSet("restore", "restore FILE [flags]")
+	cfg, path, err := parseFlagsWithArg(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	// Read and verify the whole archive before touching the database
+	dump, manifest, err := backup.Read(in)
+	if err != nil {
+		return err
+	}
+
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	m, err := services.Migrator()
+	if err != nil {
+		return err
+	}
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		return err
+	}
+	if latest := statuses[len(statuses)-1].Version; manifest.SchemaVersion > latest {
+		return fmt.Errorf("restore: the archive has schema version %d, newer than this build's %d; "+
+			"restore it with the version that wrote it (%s)", manifest.SchemaVersion, latest, manifest.AppVersion)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		return err
+	}
+
+	if err := services.Restore(dump); err != nil {
+		if err == models.ErrNotEmpty {
+			return errors.New("restore: the database is not empty; restore into a new instance, " +
+				`or clear this one with "gophotos db reset" first`)
+		}
+		return err
+	}
+	cliAudit(services, models.AuditEntry{
+		Action:     models.AuditSystemRestore,
+		TargetType: models.AuditTargetSystem,
+		Note:       fmt.Sprintf("%s, taken %s", filepath.Base(path), manifest.CreatedAt.Format(time.RFC3339)),
+	})
+	fmt.Fprintf(os.Stderr, "restored %d users, %d galleries, %d audit entries\n",
+		len(dump.Users), len(dump.Galleries), len(dump.AuditEntries))
+	return nil
+}
+
+// schemaVersion returns the latest applied migration
+func schemaVersion(services *models.Services) (int, error) {
+	m, err := services.Migrator()
+	if err != nil {
+		return 0, err
+	}
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for _, s := range statuses {
+		if s.Applied {
+			version = s.Version
+		}
+	}
+	return version, nil
+}
+
+// appVersion returns the module version of the running binary
+func appVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	return info.Main.Version
+}
+
+// writeFileAtomic writes a new file at path through a temporary file,
+// so a failed write never leaves a truncated archive behind
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gophotos-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,108 @@
+// Package assets holds the front-end files (Bootstrap, jQuery and
+// fonts) that are compiled into the binary and served by the app
+// itself rather than from third-party CDNs.
+package assets
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// PathPrefix is the URL path the assets are served under.
+const PathPrefix = "/assets/"
+
+//go:embed css fonts js
+var embedded embed.FS
+
+// files is where assets are served from. It is the copy compiled into
+// the binary unless UseDir has been called.
+var (
+	files fs.FS = embedded
+	dev   bool
+)
+
+// UseDir serves the assets from dir, the assets directory of a source
+// checkout, so changes show up on the next page load. Fingerprinting
+// is turned off and nothing is cached. It is meant for development
+// and must be called before Handler.
+func UseDir(dir string) {
+	files = os.DirFS(dir)
+	dev = true
+}
+
+// hashed maps a logical asset name such as "css/bootstrap.min.css"
+// to its fingerprinted name, e.g. "css/bootstrap.min.3f2a9c01.css".
+// original is the reverse mapping used when serving.
+var (
+	hashed   = map[string]string{}
+	original = map[string]string{}
+)
+
+func init() {
+	err := fs.WalkDir(embedded, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := embedded.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+
+		ext := path.Ext(name)
+		fingerprinted := strings.TrimSuffix(name, ext) + "." +
+			hex.EncodeToString(sum[:4]) + ext
+		hashed[name] = fingerprinted
+		original[fingerprinted] = name
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Path returns the cache-busting URL for the named asset. Unknown
+// names are returned unhashed so a typo shows up as a 404 rather
+// than a template error.
+func Path(name string) string {
+	if dev {
+		return PathPrefix + name
+	}
+	if h, ok := hashed[name]; ok {
+		return PathPrefix + h
+	}
+	return PathPrefix + name
+}
+
+// Handler serves the embedded assets under PathPrefix. Fingerprinted
+// URLs never change content, so they are cached for a year; plain
+// names (like the fonts referenced from bootstrap.min.css) are
+// revalidated on each use.
+func Handler() http.Handler {
+	fileServer := http.FileServer(http.FS(files))
+
+	return http.StripPrefix(PathPrefix, http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			name := strings.TrimPrefix(r.URL.Path, "/")
+			if name == "" || strings.HasSuffix(name, "/") {
+				// Don't expose directory listings
+				http.NotFound(w, r)
+				return
+			}
+			if orig, ok := original[name]; ok && !dev {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+				r.URL.Path = "/" + orig
+			} else {
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+			fileServer.ServeHTTP(w, r)
+		},
+	))
+}
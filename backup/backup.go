@@ -0,0 +1,235 @@
+// Package backup reads and writes backup archives: gzipped tar files
+// holding a manifest and a JSON dump of every table.
+//
+//	manifest.json        format, creation time and a SHA-256 for every file
+//	users.json
+//	galleries.json
+//	audit_entries.json
+//
+// The manifest comes first so a reader knows what to expect, and every
+// file is checked against it before anything is restored. The app does
+// not store photos yet, so format 1 archives contain no photo files.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nahuakang/gophotos/models"
+)
+
+// Format is the archive format version written by Write
+const Format = 1
+
+// Names of the files in an archive
+const (
+	ManifestFile     = "manifest.json"
+	UsersFile        = "users.json"
+	GalleriesFile    = "galleries.json"
+	AuditEntriesFile = "audit_entries.json"
+)
+
+var (
+	// ErrFormat is returned for archives that are not backups, or
+	// that were written by a newer version of the app
+	ErrFormat = errors.New("backup: unsupported archive")
+
+	// ErrChecksum is returned when a file in the archive does not
+	// match the manifest
+	ErrChecksum = errors.New("backup: checksum mismatch")
+)
+
+// Manifest describes an archive
+type Manifest struct {
+	Format    int       `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+	// AppVersion is the version of the app that wrote the archive
+	AppVersion string `json:"app_version"`
+	// SchemaVersion is the latest migration applied to the database
+	// the dump was taken from
+	SchemaVersion int    `json:"schema_version"`
+	Files         []File `json:"files"`
+}
+
+// File is an entry of the manifest
+type File struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Records int    `json:"records"`
+}
+
+// Write writes d to w as an archive. The Format and Files of m are
+// filled in by Write.
+func Write(w io.Writer, d *models.Dump, m Manifest) error {
+	users := make([]userRecord, len(d.Users))
+	for i, u := range d.Users {
+		users[i] = newUserRecord(u)
+	}
+	galleries := make([]galleryRecord, len(d.Galleries))
+	for i, g := range d.Galleries {
+		galleries[i] = newGalleryRecord(g)
+	}
+	entries := make([]auditRecord, len(d.AuditEntries))
+	for i, e := range d.AuditEntries {
+		entries[i] = newAuditRecord(e)
+	}
+
+	files := []struct {
+		name    string
+		records int
+		v       interface{}
+	}{
+		{UsersFile, len(users), users},
+		{GalleriesFile, len(galleries), galleries},
+		{AuditEntriesFile, len(entries), entries},
+	}
+	contents := make([][]byte, len(files))
+	m.Format = Format
+	m.Files = nil
+	for i, f := range files {
+		b, err := json.MarshalIndent(f.v, "", "  ")
+		if err != nil {
+			return err
+		}
+		contents[i] = b
+		m.Files = append(m.Files, File{
+			Name:    f.name,
+			Size:    int64(len(b)),
+			SHA256:  checksum(b),
+			Records: f.records,
+		})
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeFile(tw, ManifestFile, manifest, m.CreatedAt); err != nil {
+		return err
+	}
+	for i, f := range m.Files {
+		if err := writeFile(tw, f.Name, contents[i], m.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, b []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(b)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(b)
+	return err
+}
+
+// Read reads an archive written by Write and checks every file
+// against the manifest
+func Read(r io.Reader) (*models.Dump, *Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, tr); err != nil {
+			return nil, nil, err
+		}
+		files[hdr.Name] = buf.Bytes()
+	}
+
+	var m Manifest
+	manifest, ok := files[ManifestFile]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no %s", ErrFormat, ManifestFile)
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %v", ErrFormat, ManifestFile, err)
+	}
+	if m.Format < 1 || m.Format > Format {
+		return nil, nil, fmt.Errorf("%w: format %d", ErrFormat, m.Format)
+	}
+	for _, f := range m.Files {
+		b, ok := files[f.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s is missing", ErrChecksum, f.Name)
+		}
+		if int64(len(b)) != f.Size || checksum(b) != f.SHA256 {
+			return nil, nil, fmt.Errorf("%w: %s", ErrChecksum, f.Name)
+		}
+	}
+
+	var users []userRecord
+	var galleries []galleryRecord
+	var entries []auditRecord
+	for name, v := range map[string]interface{}{
+		UsersFile:        &users,
+		GalleriesFile:    &galleries,
+		AuditEntriesFile: &entries,
+	} {
+		b, ok := files[name]
+		if !ok || !listed(m, name) {
+			return nil, nil, fmt.Errorf("%w: %s is not in the manifest", ErrFormat, name)
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return nil, nil, fmt.Errorf("%w: %s: %v", ErrFormat, name, err)
+		}
+	}
+
+	d := &models.Dump{}
+	for _, u := range users {
+		d.Users = append(d.Users, u.model())
+	}
+	for _, g := range galleries {
+		d.Galleries = append(d.Galleries, g.model())
+	}
+	for _, e := range entries {
+		d.AuditEntries = append(d.AuditEntries, e.model())
+	}
+	return d, &m, nil
+}
+
+func listed(m Manifest, name string) bool {
+	for _, f := range m.Files {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,245 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nahuakang/gophotos/backup"
+	"github.com/nahuakang/gophotos/models"
+)
+
+// newSQLiteServices returns the services on a fully migrated
+// in-memory SQLite database that is closed when the test ends
+func newSQLiteServices(t *testing.T) *models.Services {
+	t.Helper()
+	services, err := models.NewServices(
+		models.WithGorm("sqlite3", ":memory:"),
+		models.WithUser("test-pepper", "test-hmac-key"),
+		models.WithGallery(),
+		models.WithAudit(),
+	)
+	if err != nil {
+		t.Fatalf("NewServices() err = %v", err)
+	}
+	t.Cleanup(func() { services.Close() })
+
+	m, err := services.Migrator()
+	if err != nil {
+		t.Fatalf("Migrator() err = %v", err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return services
+}
+
+// seed fills services with a few records, including deleted ones, and
+// returns their dump
+func seed(t *testing.T, services *models.Services) *models.Dump {
+	t.Helper()
+	var ids []uint
+	for _, email := range []string{"michael@dundermifflin.com", "dwight@dundermifflin.com", "jim@dundermifflin.com"} {
+		user := models.User{Name: email, Email: email, Password: "password123"}
+		if err := services.User.Create(&user); err != nil {
+			t.Fatalf("User.Create() err = %v", err)
+		}
+		ids = append(ids, user.ID)
+	}
+	if err := services.User.Delete(ids[0]); err != nil {
+		t.Fatalf("User.Delete() err = %v", err)
+	}
+	for _, title := range []string{"Dundies", "Beet farm", "Pranks"} {
+		gallery := models.Gallery{UserID: ids[1], Title: title}
+		if err := services.Gallery.Create(&gallery); err != nil {
+			t.Fatalf("Gallery.Create() err = %v", err)
+		}
+	}
+	if err := services.Gallery.Delete(2); err != nil {
+		t.Fatalf("Gallery.Delete() err = %v", err)
+	}
+	err := services.Audit.Record(&models.AuditEntry{
+		ActorID:    ids[1],
+		Action:     models.AuditGalleryCreate,
+		TargetType: models.AuditTargetGallery,
+		TargetID:   1,
+		Note:       "Dundies",
+	})
+	if err != nil {
+		t.Fatalf("Audit.Record() err = %v", err)
+	}
+
+	dump, err := services.Dump()
+	if err != nil {
+		t.Fatalf("Dump() err = %v", err)
+	}
+	return dump
+}
+
+func writeArchive(t *testing.T, dump *models.Dump) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := backup.Write(&buf, dump, backup.Manifest{
+		CreatedAt:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		AppVersion:    "test",
+		SchemaVersion: 6,
+	})
+	if err != nil {
+		t.Fatalf("Write() err = %v, want nil", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := newSQLiteServices(t)
+	want := seed(t, src)
+	archive := writeArchive(t, want)
+
+	dump, manifest, err := backup.Read(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Read() err = %v, want nil", err)
+	}
+	if manifest.Format != backup.Format || manifest.AppVersion != "test" || manifest.SchemaVersion != 6 {
+		t.Errorf("manifest = %+v, want format %d, app version test and schema 6", manifest, backup.Format)
+	}
+	records := map[string]int{}
+	for _, f := range manifest.Files {
+		records[f.Name] = f.Records
+	}
+	wantRecords := map[string]int{backup.UsersFile: 3, backup.GalleriesFile: 3, backup.AuditEntriesFile: 1}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("manifest records = %v, want %v", records, wantRecords)
+	}
+
+	dst := newSQLiteServices(t)
+	if err := dst.Restore(dump); err != nil {
+		t.Fatalf("Restore() err = %v, want nil", err)
+	}
+	got, err := dst.Dump()
+	if err != nil {
+		t.Fatalf("Dump() of the restored database err = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored records differ:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	// IDs are kept, and so are the gaps left by deleted records
+	if _, err := dst.User.ByID(1); err != models.ErrNotFound {
+		t.Errorf("ByID(1) of a deleted user err = %v, want %v", err, models.ErrNotFound)
+	}
+	gallery, err := dst.Gallery.ByID(3)
+	if err != nil {
+		t.Fatalf("Gallery.ByID(3) err = %v, want nil", err)
+	}
+	if gallery.Title != "Pranks" || gallery.UserID != 2 {
+		t.Errorf("gallery 3 = %q of user %d, want Pranks of user 2", gallery.Title, gallery.UserID)
+	}
+	if _, err := dst.User.Authenticate("jim@dundermifflin.com", "password123"); err != nil {
+		t.Errorf("Authenticate() with the restored password hash err = %v, want nil", err)
+	}
+}
+
+// rewrite returns archive with the contents of the named file replaced
+func rewrite(t *testing.T, archive []byte, name string, edit func([]byte) []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == name {
+			b = edit(b)
+			hdr.Size = int64(len(b))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(b)
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestTamperedArchive(t *testing.T) {
+	archive := writeArchive(t, seed(t, newSQLiteServices(t)))
+
+	tests := []struct {
+		name string
+		edit func([]byte) []byte
+	}{
+		{"changed byte", func(b []byte) []byte {
+			return bytes.Replace(b, []byte("Pranks"), []byte("Prankz"), 1)
+		}},
+		{"same size", func(b []byte) []byte {
+			return bytes.Replace(b, []byte(`"user_id": 2`), []byte(`"user_id": 3`), 1)
+		}},
+		{"truncated", func(b []byte) []byte { return b[:len(b)/2] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := rewrite(t, archive, backup.GalleriesFile, tt.edit)
+			if bytes.Equal(tampered, archive) {
+				t.Fatalf("the archive was not changed")
+			}
+			_, _, err := backup.Read(bytes.NewReader(tampered))
+			if !errors.Is(err, backup.ErrChecksum) {
+				t.Errorf("Read() err = %v, want %v", err, backup.ErrChecksum)
+			}
+		})
+	}
+}
+
+func TestNotAnArchive(t *testing.T) {
+	_, _, err := backup.Read(bytes.NewReader([]byte("users,galleries\n")))
+	if !errors.Is(err, backup.ErrFormat) {
+		t.Errorf("Read() err = %v, want %v", err, backup.ErrFormat)
+	}
+}
+
+func TestRestoreIntoNonEmptyDatabase(t *testing.T) {
+	dump, _, err := backup.Read(bytes.NewReader(writeArchive(t, seed(t, newSQLiteServices(t)))))
+	if err != nil {
+		t.Fatalf("Read() err = %v, want nil", err)
+	}
+
+	dst := newSQLiteServices(t)
+	user := models.User{Name: "Pam", Email: "pam@dundermifflin.com", Password: "password123"}
+	if err := dst.User.Create(&user); err != nil {
+		t.Fatalf("User.Create() err = %v", err)
+	}
+	if err := dst.Restore(dump); err != models.ErrNotEmpty {
+		t.Fatalf("Restore() err = %v, want %v", err, models.ErrNotEmpty)
+	}
+
+	// Nothing was restored
+	users, err := dst.User.All()
+	if err != nil {
+		t.Fatalf("All() err = %v", err)
+	}
+	if len(users) != 1 || users[0].Email != user.Email {
+		t.Errorf("users after a refused restore = %+v, want only Pam", users)
+	}
+}
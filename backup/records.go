@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/nahuakang/gophotos/models"
+)
+
+// The records below fix the JSON layout of an archive, so it doesn't
+// change whenever a field is added to a model.
+
+type userRecord struct {
+	ID           uint       `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	Name         string     `json:"name"`
+	Email        string     `json:"email"`
+	PasswordHash string     `json:"password_hash"`
+	RememberHash string     `json:"remember_hash"`
+	Admin        bool       `json:"admin"`
+	Disabled     bool       `json:"disabled"`
+}
+
+func newUserRecord(u models.User) userRecord {
+	return userRecord{
+		ID:           u.ID,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    u.UpdatedAt,
+		DeletedAt:    u.DeletedAt,
+		Name:         u.Name,
+		Email:        u.Email,
+		PasswordHash: u.PasswordHash,
+		RememberHash: u.RememberHash,
+		Admin:        u.Admin,
+		Disabled:     u.Disabled,
+	}
+}
+
+func (r userRecord) model() models.User {
+	return models.User{
+		Model: gorm.Model{
+			ID:        r.ID,
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+			DeletedAt: r.DeletedAt,
+		},
+		Name:         r.Name,
+		Email:        r.Email,
+		PasswordHash: r.PasswordHash,
+		RememberHash: r.RememberHash,
+		Admin:        r.Admin,
+		Disabled:     r.Disabled,
+	}
+}
+
+type galleryRecord struct {
+	ID        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	UserID    uint       `json:"user_id"`
+	Title     string     `json:"title"`
+}
+
+func newGalleryRecord(g models.Gallery) galleryRecord {
+	return galleryRecord{
+		ID:        g.ID,
+		CreatedAt: g.CreatedAt,
+		UpdatedAt: g.UpdatedAt,
+		DeletedAt: g.DeletedAt,
+		UserID:    g.UserID,
+		Title:     g.Title,
+	}
+}
+
+func (r galleryRecord) model() models.Gallery {
+	return models.Gallery{
+		Model: gorm.Model{
+			ID:        r.ID,
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+			DeletedAt: r.DeletedAt,
+		},
+		UserID: r.UserID,
+		Title:  r.Title,
+	}
+}
+
+type auditRecord struct {
+	ID         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ActorID    uint      `json:"actor_id"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   uint      `json:"target_id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Note       string    `json:"note"`
+	Changes    string    `json:"changes"`
+	Admin      bool      `json:"admin"`
+}
+
+func newAuditRecord(e models.AuditEntry) auditRecord {
+	return auditRecord{
+		ID:         e.ID,
+		CreatedAt:  e.CreatedAt,
+		ActorID:    e.ActorID,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		Note:       e.Note,
+		Changes:    e.Changes,
+		Admin:      e.Admin,
+	}
+}
+
+func (r auditRecord) model() models.AuditEntry {
+	return models.AuditEntry{
+		ID:         r.ID,
+		CreatedAt:  r.CreatedAt,
+		ActorID:    r.ActorID,
+		Action:     r.Action,
+		TargetType: r.TargetType,
+		TargetID:   r.TargetID,
+		IP:         r.IP,
+		UserAgent:  r.UserAgent,
+		Note:       r.Note,
+		Changes:    r.Changes,
+		Admin:      r.Admin,
+	}
+}
@@ -0,0 +1,21 @@
+// Package cache holds short-lived copies of values that are expensive
+// to look up, such as the user behind a session cookie. Values are
+// kept in a Store, either in process memory (LRU) for a single
+// instance of the app or in memcached (Memcached) to share them, and
+// their invalidations, between instances.
+package cache
+
+import "time"
+
+// Store is a key/value cache. Values expire after their TTL and may be
+// dropped earlier, so a Store can only ever be used to skip work that
+// can be redone.
+type Store interface {
+	// Get returns the value stored under key, and whether there was
+	// one
+	Get(key string) ([]byte, bool, error)
+	// Set stores value under key for ttl
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLRU returns an LRU whose clock only moves when the returned
+// function is called
+func newTestLRU(size int) (*LRU, func(time.Duration)) {
+	c := NewLRU(size)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+func mustGet(t *testing.T, c *LRU, key string) (string, bool) {
+	t.Helper()
+	b, ok, err := c.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q) err = %v, want nil", key, err)
+	}
+	return string(b), ok
+}
+
+func TestLRUGetSet(t *testing.T) {
+	c, _ := newTestLRU(2)
+	if _, ok := mustGet(t, c, "a"); ok {
+		t.Errorf("Get(a) on an empty cache found a value")
+	}
+
+	c.Set("a", []byte("1"), time.Minute)
+	if got, ok := mustGet(t, c, "a"); !ok || got != "1" {
+		t.Errorf("Get(a) = %q, %v, want %q, true", got, ok, "1")
+	}
+
+	c.Set("a", []byte("2"), time.Minute)
+	if got, ok := mustGet(t, c, "a"); !ok || got != "2" {
+		t.Errorf("Get(a) after overwriting = %q, %v, want %q, true", got, ok, "2")
+	}
+	if n := c.Len(); n != 1 {
+		t.Errorf("Len() = %d, want 1", n)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	c, _ := newTestLRU(2)
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), time.Minute)
+	// Reading a makes b the least recently used
+	mustGet(t, c, "a")
+	c.Set("c", []byte("3"), time.Minute)
+
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len() = %d, want 2", n)
+	}
+	if _, ok := mustGet(t, c, "b"); ok {
+		t.Errorf("Get(b) found the least recently used value, want it evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := mustGet(t, c, key); !ok {
+			t.Errorf("Get(%s) found nothing, want the value kept", key)
+		}
+	}
+}
+
+func TestLRUTTL(t *testing.T) {
+	c, advance := newTestLRU(2)
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), time.Hour)
+
+	advance(time.Minute - time.Second)
+	if _, ok := mustGet(t, c, "a"); !ok {
+		t.Errorf("Get(a) before its TTL found nothing")
+	}
+
+	advance(2 * time.Second)
+	if _, ok := mustGet(t, c, "a"); ok {
+		t.Errorf("Get(a) after its TTL found a value")
+	}
+	if n := c.Len(); n != 1 {
+		t.Errorf("Len() = %d after reading an expired value, want 1", n)
+	}
+	if _, ok := mustGet(t, c, "b"); !ok {
+		t.Errorf("Get(b) before its TTL found nothing")
+	}
+
+	// Setting a value again starts a new TTL
+	c.Set("b", []byte("3"), time.Minute)
+	advance(time.Hour)
+	if _, ok := mustGet(t, c, "b"); ok {
+		t.Errorf("Get(b) after the TTL of its new value found a value")
+	}
+}
+
+func TestLRUDelete(t *testing.T) {
+	c, _ := newTestLRU(2)
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), time.Minute)
+
+	if err := c.Delete("a"); err != nil {
+		t.Fatalf("Delete(a) err = %v, want nil", err)
+	}
+	if _, ok := mustGet(t, c, "a"); ok {
+		t.Errorf("Get(a) after Delete found a value")
+	}
+	if _, ok := mustGet(t, c, "b"); !ok {
+		t.Errorf("Get(b) found nothing after deleting a")
+	}
+	if err := c.Delete("missing"); err != nil {
+		t.Errorf("Delete(missing) err = %v, want nil", err)
+	}
+
+	// The deleted entry no longer counts towards the size
+	c.Set("c", []byte("3"), time.Minute)
+	if _, ok := mustGet(t, c, "b"); !ok {
+		t.Errorf("Get(b) found nothing, want it kept after adding c")
+	}
+}
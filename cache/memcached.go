@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIdleConns is how many connections Memcached keeps open between
+// requests
+const maxIdleConns = 8
+
+// maxTTL is the longest expiry memcached accepts as a relative time;
+// anything longer is read as a unix timestamp.
+const maxTTL = 30 * 24 * time.Hour
+
+// ErrKey is returned for keys memcached cannot store: longer than 250
+// bytes, or containing spaces or control characters.
+var ErrKey = errors.New("cache: invalid memcached key")
+
+// NewMemcached returns a Store backed by the memcached server at addr,
+// e.g. "localhost:11211". Every key is prefixed with prefix so several
+// apps can share a server. Operations give up after timeout.
+func NewMemcached(addr, prefix string, timeout time.Duration) *Memcached {
+	return &Memcached{
+		addr:    addr,
+		prefix:  prefix,
+		timeout: timeout,
+	}
+}
+
+// Memcached is a Store shared by every instance of the app that uses
+// the same server. It speaks the memcached text protocol and is safe
+// for concurrent use.
+type Memcached struct {
+	addr    string
+	prefix  string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	idle []*mcConn
+}
+
+type mcConn struct {
+	nc net.Conn
+	rw *bufio.ReadWriter
+}
+
+// Ensure Memcached implements Store interface
+var _ Store = &Memcached{}
+
+// Get implements Store
+func (m *Memcached) Get(key string) ([]byte, bool, error) {
+	key, err := m.key(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var value []byte
+	var found bool
+	err = m.do(func(c *mcConn) error {
+		fmt.Fprintf(c.rw, "get %s\r\n", key)
+		if err := c.rw.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readLine(c.rw)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			// VALUE <key> <flags> <bytes>
+			fields := strings.Fields(line)
+			if len(fields) != 4 || fields[0] != "VALUE" {
+				return fmt.Errorf("cache: unexpected memcached reply %q", line)
+			}
+			n, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return fmt.Errorf("cache: unexpected memcached reply %q", line)
+			}
+			buf := make([]byte, n+2)
+			if _, err := io.ReadFull(c.rw, buf); err != nil {
+				return err
+			}
+			if !bytes.HasSuffix(buf, []byte("\r\n")) {
+				return errors.New("cache: corrupt memcached value")
+			}
+			value, found = buf[:n], true
+		}
+	})
+	return value, found, err
+}
+
+// Set implements Store
+func (m *Memcached) Set(key string, value []byte, ttl time.Duration) error {
+	key, err := m.key(key)
+	if err != nil {
+		return err
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+	seconds := int((ttl + time.Second - 1) / time.Second)
+
+	return m.do(func(c *mcConn) error {
+		fmt.Fprintf(c.rw, "set %s 0 %d %d\r\n", key, seconds, len(value))
+		c.rw.Write(value)
+		c.rw.WriteString("\r\n")
+		if err := c.rw.Flush(); err != nil {
+			return err
+		}
+		return expectReply(c.rw, "STORED")
+	})
+}
+
+// Delete implements Store
+func (m *Memcached) Delete(key string) error {
+	key, err := m.key(key)
+	if err != nil {
+		return err
+	}
+
+	return m.do(func(c *mcConn) error {
+		fmt.Fprintf(c.rw, "delete %s\r\n", key)
+		if err := c.rw.Flush(); err != nil {
+			return err
+		}
+		return expectReply(c.rw, "DELETED", "NOT_FOUND")
+	})
+}
+
+// do runs fn on a pooled connection. Connections that fail are closed
+// rather than reused, since their protocol state is unknown.
+func (m *Memcached) do(fn func(*mcConn) error) error {
+	c, err := m.conn()
+	if err != nil {
+		return err
+	}
+	c.nc.SetDeadline(time.Now().Add(m.timeout))
+	if err := fn(c); err != nil {
+		c.nc.Close()
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.idle) >= maxIdleConns {
+		c.nc.Close()
+		return nil
+	}
+	m.idle = append(m.idle, c)
+	return nil
+}
+
+func (m *Memcached) conn() (*mcConn, error) {
+	m.mu.Lock()
+	if n := len(m.idle); n > 0 {
+		c := m.idle[n-1]
+		m.idle = m.idle[:n-1]
+		m.mu.Unlock()
+		return c, nil
+	}
+	m.mu.Unlock()
+
+	nc, err := net.DialTimeout("tcp", m.addr, m.timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &mcConn{
+		nc: nc,
+		rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc)),
+	}, nil
+}
+
+// Close closes the idle connections
+func (m *Memcached) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.idle {
+		c.nc.Close()
+	}
+	m.idle = nil
+	return nil
+}
+
+func (m *Memcached) key(key string) (string, error) {
+	key = m.prefix + key
+	if len(key) > 250 {
+		return "", ErrKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return "", ErrKey
+		}
+	}
+	return key, nil
+}
+
+func readLine(r *bufio.ReadWriter) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+// expectReply reads a reply line and checks that it is one of want
+func expectReply(r *bufio.ReadWriter, want ...string) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	for _, w := range want {
+		if line == w {
+			return nil
+		}
+	}
+	return fmt.Errorf("cache: memcached replied %q", line)
+}
@@ -0,0 +1,315 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMemcached is a memcached server speaking just enough of the text
+// protocol for Memcached: get of a single key, set and delete
+type fakeMemcached struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	items    map[string][]byte
+	commands []string
+	conns    int
+	// reply, if set, answers every command instead of the store. An
+	// empty reply closes the connection without answering.
+	reply func(cmd string) string
+}
+
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	f := &fakeMemcached{ln: ln, items: map[string][]byte{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			f.mu.Unlock()
+			go f.serve(nc)
+		}
+	}()
+	return f
+}
+
+// newTestMemcached returns a client of f using the prefix "test:"
+func newTestMemcached(t *testing.T, f *fakeMemcached) *Memcached {
+	t.Helper()
+	m := NewMemcached(f.ln.Addr().String(), "test:", time.Second)
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func (f *fakeMemcached) serve(nc net.Conn) {
+	defer nc.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc))
+	for {
+		line, err := readLine(rw)
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		var data []byte
+		if len(fields) == 5 && fields[0] == "set" {
+			n, _ := strconv.Atoi(fields[4])
+			data = make([]byte, n+2)
+			if _, err := io.ReadFull(rw, data); err != nil {
+				return
+			}
+			data = data[:n]
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, line)
+		reply := f.reply
+		var out string
+		if reply == nil {
+			out = f.answer(fields, data)
+		}
+		f.mu.Unlock()
+		if reply != nil {
+			out = reply(line)
+		}
+
+		if out == "" {
+			return
+		}
+		rw.WriteString(out)
+		rw.Flush()
+	}
+}
+
+// answer replies to a command from the store; f.mu must be held
+func (f *fakeMemcached) answer(fields []string, data []byte) string {
+	switch fields[0] {
+	case "get":
+		v, ok := f.items[fields[1]]
+		if !ok {
+			return "END\r\n"
+		}
+		return fmt.Sprintf("VALUE %s 0 %d\r\n%s\r\nEND\r\n", fields[1], len(v), v)
+	case "set":
+		f.items[fields[1]] = data
+		return "STORED\r\n"
+	case "delete":
+		if _, ok := f.items[fields[1]]; !ok {
+			return "NOT_FOUND\r\n"
+		}
+		delete(f.items, fields[1])
+		return "DELETED\r\n"
+	}
+	return "ERROR\r\n"
+}
+
+func (f *fakeMemcached) setReply(reply func(cmd string) string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reply = reply
+}
+
+func (f *fakeMemcached) lastCommand() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.commands) == 0 {
+		return ""
+	}
+	return f.commands[len(f.commands)-1]
+}
+
+func (f *fakeMemcached) connCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns
+}
+
+func TestMemcachedGetSetDelete(t *testing.T) {
+	f := newFakeMemcached(t)
+	m := newTestMemcached(t, f)
+
+	if _, ok, err := m.Get("user:1"); ok || err != nil {
+		t.Fatalf("Get() of a missing key = %v, %v, want a miss", ok, err)
+	}
+
+	// Values may contain the protocol's line ending
+	value := []byte("{\"name\":\"Michael\"}\r\nEND\r\n")
+	if err := m.Set("user:1", value, time.Minute); err != nil {
+		t.Fatalf("Set() err = %v, want nil", err)
+	}
+	if got := f.lastCommand(); got != fmt.Sprintf("set test:user:1 0 60 %d", len(value)) {
+		t.Errorf("Set() sent %q, want the prefixed key, a 60 second expiry and the length", got)
+	}
+	got, ok, err := m.Get("user:1")
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v, want a hit", ok, err)
+	}
+	if string(got) != string(value) {
+		t.Errorf("Get() = %q, want %q", got, value)
+	}
+
+	if err := m.Delete("user:1"); err != nil {
+		t.Fatalf("Delete() err = %v, want nil", err)
+	}
+	if _, ok, err := m.Get("user:1"); ok || err != nil {
+		t.Errorf("Get() after Delete() = %v, %v, want a miss", ok, err)
+	}
+	// NOT_FOUND is not an error
+	if err := m.Delete("user:1"); err != nil {
+		t.Errorf("Delete() of a missing key err = %v, want nil", err)
+	}
+
+	if n := f.connCount(); n != 1 {
+		t.Errorf("opened %d connections, want 1 reused for every command", n)
+	}
+}
+
+func TestMemcachedTTL(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want string
+	}{
+		{1500 * time.Millisecond, "2"},
+		{time.Hour, "3600"},
+		// Longer expiries would be read as unix timestamps
+		{60 * 24 * time.Hour, "2592000"},
+	}
+	f := newFakeMemcached(t)
+	m := newTestMemcached(t, f)
+	for _, tt := range tests {
+		if err := m.Set("k", []byte("v"), tt.ttl); err != nil {
+			t.Fatalf("Set() err = %v, want nil", err)
+		}
+		if got := strings.Fields(f.lastCommand())[3]; got != tt.want {
+			t.Errorf("Set() with ttl %v sent expiry %s, want %s", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestMemcachedInvalidKey(t *testing.T) {
+	f := newFakeMemcached(t)
+	m := newTestMemcached(t, f)
+	keys := map[string]string{
+		"space":    "user 1",
+		"newline":  "user\r\n1",
+		"control":  "user\x001",
+		"delete":   "user\x7f",
+		"too long": strings.Repeat("k", 250-len("test:")+1),
+	}
+	for name, key := range keys {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := m.Get(key); err != ErrKey {
+				t.Errorf("Get() err = %v, want %v", err, ErrKey)
+			}
+			if err := m.Set(key, []byte("v"), time.Minute); err != ErrKey {
+				t.Errorf("Set() err = %v, want %v", err, ErrKey)
+			}
+			if err := m.Delete(key); err != ErrKey {
+				t.Errorf("Delete() err = %v, want %v", err, ErrKey)
+			}
+		})
+	}
+	if got := f.lastCommand(); got != "" {
+		t.Errorf("sent %q, want invalid keys never sent", got)
+	}
+	if err := m.Set(strings.Repeat("k", 250-len("test:")), []byte("v"), time.Minute); err != nil {
+		t.Errorf("Set() of a 250 byte key err = %v, want nil", err)
+	}
+}
+
+func TestMemcachedBadReplies(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    func(*Memcached) error
+		reply string
+	}{
+		{"get without a length", getOp, "VALUE test:k 0\r\n"},
+		{"get with a bad length", getOp, "VALUE test:k 0 five\r\nhello\r\nEND\r\n"},
+		{"get with a corrupt value", getOp, "VALUE test:k 0 3\r\nhello\r\nEND\r\n"},
+		{"get error", getOp, "SERVER_ERROR out of memory\r\n"},
+		{"set not stored", setOp, "NOT_STORED\r\n"},
+		{"set error", setOp, "SERVER_ERROR object too large for cache\r\n"},
+		{"delete error", deleteOp, "ERROR\r\n"},
+		{"connection closed", getOp, ""},
+		{"set connection closed", setOp, ""},
+		{"delete connection closed", deleteOp, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeMemcached(t)
+			m := newTestMemcached(t, f)
+			reply := tt.reply
+			f.setReply(func(string) string { return reply })
+			if err := tt.op(m); err == nil {
+				t.Fatalf("err = nil, want an error for the reply %q", tt.reply)
+			}
+
+			// The broken connection is dropped rather than reused
+			f.setReply(nil)
+			if _, _, err := m.Get("k"); err != nil {
+				t.Errorf("Get() after a bad reply err = %v, want nil", err)
+			}
+			if n := f.connCount(); n != 2 {
+				t.Errorf("opened %d connections, want a new one after the bad reply", n)
+			}
+		})
+	}
+}
+
+func getOp(m *Memcached) error {
+	_, _, err := m.Get("k")
+	return err
+}
+
+func setOp(m *Memcached) error {
+	return m.Set("k", []byte("v"), time.Minute)
+}
+
+func deleteOp(m *Memcached) error {
+	return m.Delete("k")
+}
+
+func TestMemcachedTimeout(t *testing.T) {
+	f := newFakeMemcached(t)
+	hang := make(chan struct{})
+	defer close(hang)
+	f.setReply(func(string) string {
+		<-hang
+		return ""
+	})
+
+	m := NewMemcached(f.ln.Addr().String(), "test:", 50*time.Millisecond)
+	defer m.Close()
+	_, _, err := m.Get("k")
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Get() err = %v, want a timeout", err)
+	}
+}
+
+func TestMemcachedUnreachable(t *testing.T) {
+	f := newFakeMemcached(t)
+	addr := f.ln.Addr().String()
+	f.ln.Close()
+
+	m := NewMemcached(addr, "test:", time.Second)
+	if _, _, err := m.Get("k"); err == nil {
+		t.Errorf("Get() err = nil, want an error when the server is down")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nahuakang/gophotos/config"
+	"github.com/nahuakang/gophotos/models"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const usage = `usage: gophotos <command> [arguments] [flags]
+
+commands:
+  serve                        run the web app (the default)
+  migrate up|down|status       apply, roll back or list schema migrations
+  db reset                     drop every table and migrate from scratch
+  user create|list|disable|set-password
+                               manage user accounts
+  gallery list|transfer-owner  manage galleries
+  backup [-o FILE]             write users, galleries and the audit log to an archive
+  restore FILE                 load an archive into an empty database
+
+Every command accepts the config flags (-config, -env, -db-host, ...).
+Run "gophotos <command> -h" for the flags of a command.`
+
+// errUsage is returned when a command is called with bad arguments.
+// The usage text has already been printed.
+var errUsage = errors.New("invalid usage")
+
+// parseFlags parses args with fs, which gets the config flags on top
+// of its own, and returns the resulting config
+func parseFlags(fs *flag.FlagSet, args []string) (config.Config, error) {
+	load := config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return config.Config{}, errUsage
+		}
+		return config.Config{}, err
+	}
+	return load()
+}
+
+// parseFlagsWithArg is parseFlags for commands that take a single
+// positional argument. Flags may come before or after the argument;
+// "-" on its own is taken as the argument, e.g. for stdin.
+func parseFlagsWithArg(fs *flag.FlagSet, args []string) (config.Config, string, error) {
+	var arg string
+	if len(args) > 0 && (args[0] == "-" || !strings.HasPrefix(args[0], "-")) {
+		arg, args = args[0], args[1:]
+	}
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return cfg, "", err
+	}
+	if arg == "" && fs.NArg() == 1 {
+		arg = fs.Arg(0)
+	} else if fs.NArg() > 0 {
+		arg = ""
+	}
+	if arg == "" {
+		fs.Usage()
+		return cfg, "", errUsage
+	}
+	return cfg, arg, nil
+}
+
+// parseFlagsWithID is parseFlags for commands that take a record ID
+// as their first argument. Flags may come before or after the ID.
+func parseFlagsWithID(fs *flag.FlagSet, args []string) (config.Config, uint, error) {
+	cfg, idArg, err := parseFlagsWithArg(fs, args)
+	if err != nil {
+		return cfg, 0, err
+	}
+	id, err := strconv.ParseUint(idArg, 10, 64)
+	if err != nil || id == 0 {
+		fs.Usage()
+		return cfg, 0, errUsage
+	}
+	return cfg, uint(id), nil
+}
+
+// newFlagSet returns a flag set for the command name that prints
+// synopsis above the flag defaults on -h or a bad flag
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gophotos %s\n\nflags:\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// cliAudit records an administrative action taken from the command
+// line. Failures are reported but don't undo the action.
+func cliAudit(services *models.Services, entry models.AuditEntry) {
+	entry.Admin = true
+	entry.UserAgent = "gophotos-cli"
+	if err := services.Audit.Record(&entry); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: recording audit entry: %v\n", err)
+	}
+}
+
+// confirm asks question on stderr and reports whether the answer read
+// from in equals want
+func confirm(in io.Reader, question, want string) bool {
+	fmt.Fprint(os.Stderr, question)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+	return strings.TrimSpace(line) == want
+}
+
+// readPassword reads a password from the terminal without echoing it,
+// asking twice. When stdin is not a terminal it reads a single line,
+// so passwords can be piped in from a secrets manager.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading password: %v", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	pw, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	again, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(pw) != string(again) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(pw), nil
+}
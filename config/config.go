@@ -0,0 +1,649 @@
+// Package config loads the app's settings. Values are read, in order
+// of increasing precedence, from the defaults, a JSON file, GOPHOTOS_*
+// environment variables and command-line flags.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environments
+const (
+	EnvDevelopment = "dev"
+	EnvProduction  = "prod"
+)
+
+// DefaultFile is the config file read when -config is not given.
+// It is optional; a missing default file is not an error.
+const DefaultFile = ".config.json"
+
+// Development secrets. Validate refuses to run with these in
+// production.
+const (
+	devHMACKey   = "secret-hmac-key"
+	devPepper    = "secret-random-string"
+	devCSRFKey   = "gophotos-csrf-secret-32-byte-key"
+	devCookieKey = "gophotos-cookie-signing-key"
+)
+
+// Config holds every setting of the app
+type Config struct {
+	Env      string         `json:"env"`
+	Addr     string         `json:"addr"`
+	Server   ServerConfig   `json:"server"`
+	TLS      TLSConfig      `json:"tls"`
+	Database DatabaseConfig `json:"database"`
+	Metrics  MetricsConfig  `json:"metrics"`
+	Tracing  TracingConfig  `json:"tracing"`
+	Cookie   CookieConfig   `json:"cookie"`
+	// UserCache caches the user lookups done for every request of
+	// a signed in user
+	UserCache UserCacheConfig `json:"user_cache"`
+	// HMACKey hashes remember tokens before they are stored
+	HMACKey string `json:"hmac_key"`
+	// Pepper is added to every password before it is hashed
+	Pepper string `json:"pepper"`
+	// CSRFKey authenticates CSRF cookies and must be 32 bytes long
+	CSRFKey string `json:"csrf_key"`
+	// CookieKey signs the remember_token cookie and flash messages
+	CookieKey string `json:"cookie_key"`
+	// RateLimitStore is "memory" for a single instance, or
+	// "database" to share limits between instances
+	RateLimitStore string `json:"rate_limit_store"`
+	// DevDir is a source checkout to read templates and assets from
+	// instead of the copies compiled into the binary. Templates are
+	// parsed again on every request, so changes show up without a
+	// restart. Development only.
+	DevDir string `json:"dev_dir"`
+}
+
+// ServerConfig holds the HTTP server's timeouts
+type ServerConfig struct {
+	// ReadHeaderTimeout limits how long reading request headers may take
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	// ReadTimeout limits how long reading a whole request, including
+	// uploads, may take
+	ReadTimeout Duration `json:"read_timeout"`
+	// WriteTimeout limits how long writing a response may take
+	WriteTimeout Duration `json:"write_timeout"`
+	// IdleTimeout is how long keep-alive connections stay open
+	IdleTimeout Duration `json:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests get to finish
+	// after a shutdown signal before they are cut off
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+}
+
+// CookieConfig controls how long the remember cookie keeps users
+// signed in. Cookies are re-issued on use once they are RefreshAfter
+// old, so only idle users are signed out.
+type CookieConfig struct {
+	// Lifetime is how long a "remember me" cookie stays valid
+	Lifetime Duration `json:"lifetime"`
+	// SessionLifetime is how long a cookie without "remember me",
+	// which the browser drops when it closes, stays valid
+	SessionLifetime Duration `json:"session_lifetime"`
+	// RefreshAfter is how old a cookie has to be to be re-issued
+	RefreshAfter Duration `json:"refresh_after"`
+}
+
+// MetricsConfig controls access to the Prometheus /metrics endpoint.
+// With Addr set, metrics are served on that address only, e.g. one
+// that is not exposed to the internet; otherwise they are served on
+// the app's own listener. Username and Password, if set, require basic
+// authentication. In production, metrics on the app's listener are
+// only served with authentication.
+type MetricsConfig struct {
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Protected reports whether metrics require basic authentication
+func (c MetricsConfig) Protected() bool {
+	return c.Username != "" && c.Password != ""
+}
+
+// Tracing exporters
+const (
+	TraceNone   = "none"
+	TraceStderr = "stderr"
+	TraceFile   = "file"
+)
+
+// TracingConfig controls request tracing. Spans are written as
+// OTLP/JSON lines to stderr, away from the request log on stdout, or
+// to File, so they can be inspected offline or loaded into a tracing
+// backend.
+type TracingConfig struct {
+	// Exporter is "none", "stderr" or "file"
+	Exporter string `json:"exporter"`
+	File     string `json:"file"`
+	// SampleRatio is the share of new traces that are recorded,
+	// from 0 to 1. Incoming traceparent headers override it.
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// Enabled reports whether spans are exported anywhere
+func (c TracingConfig) Enabled() bool {
+	return c.Exporter == TraceStderr || c.Exporter == TraceFile
+}
+
+// User cache stores
+const (
+	CacheNone      = "none"
+	CacheMemory    = "memory"
+	CacheMemcached = "memcached"
+)
+
+// UserCacheConfig controls the user cache, which is off by default.
+// With the memory store each instance has a cache of its own, so a
+// change made elsewhere, e.g. by "gophotos user disable" or "gophotos
+// user set-password", only ends sessions once TTL has passed; memcached
+// shares the cache, and its invalidations, between instances and the
+// CLI.
+type UserCacheConfig struct {
+	// Store is "none", "memory" or "memcached"
+	Store string `json:"store"`
+	// Size is the most users the memory store holds
+	Size int      `json:"size"`
+	TTL  Duration `json:"ttl"`
+	// MemcachedAddr is the memcached server, e.g. "localhost:11211"
+	MemcachedAddr string `json:"memcached_addr"`
+}
+
+// TLSConfig holds the settings for serving HTTPS directly. TLS is
+// enabled when both CertFile and KeyFile are set.
+type TLSConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// RedirectAddr is an optional plain HTTP address, e.g. ":80",
+	// that redirects every request to HTTPS
+	RedirectAddr string `json:"redirect_addr"`
+	// ReloadInterval is how often the certificate files are checked
+	// for changes. They are also reloaded on SIGHUP.
+	ReloadInterval Duration `json:"reload_interval"`
+}
+
+// Enabled reports whether the app should serve HTTPS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// Duration is a time.Duration written in config files as a string
+// such as "30s" or "5m"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
+
+// SQL logging modes
+const (
+	LogSQLAll    = "all"
+	LogSQLSlow   = "slow"
+	LogSQLErrors = "errors"
+)
+
+// DatabaseConfig holds the database connection settings. Postgres is
+// configured with the individual fields unless DSN is set; SQLite
+// always uses DSN, which is a file path or ":memory:".
+type DatabaseConfig struct {
+	Driver   string `json:"driver"`
+	DSN      string `json:"dsn"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	SSLMode  string `json:"sslmode"`
+	// ReplicaDSN is an optional read replica's connection string.
+	// Lookups and listings are read from it; writes, sign in and
+	// everything else use the primary.
+	ReplicaDSN string `json:"replica_dsn"`
+	// MaxOpenConns and MaxIdleConns limit each connection pool;
+	// 0 means no limit and the database/sql default respectively.
+	MaxOpenConns int `json:"max_open_conns"`
+	MaxIdleConns int `json:"max_idle_conns"`
+	// ConnMaxLifetime and ConnMaxIdleTime close connections after
+	// that long in total or unused; 0 keeps them open
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time"`
+	// LogSQL is "all" to log every statement, "slow" for statements
+	// taking at least SlowQuery, or "errors". It defaults to "all" in
+	// development and "errors" in production.
+	LogSQL    string   `json:"log_sql"`
+	SlowQuery Duration `json:"slow_query"`
+}
+
+// SQLLogging returns the LogSQL mode, resolving the default for env
+func (c DatabaseConfig) SQLLogging(env string) string {
+	if c.LogSQL != "" {
+		return c.LogSQL
+	}
+	if env == EnvProduction {
+		return LogSQLErrors
+	}
+	return LogSQLAll
+}
+
+// Dialect returns the gorm dialect for the database
+func (c DatabaseConfig) Dialect() string {
+	return c.Driver
+}
+
+// ConnectionInfo returns the connection string for the database
+func (c DatabaseConfig) ConnectionInfo() string {
+	if c.DSN != "" {
+		return c.DSN
+	}
+	info := fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Name, c.SSLMode)
+	if c.Password != "" {
+		info += " password=" + c.Password
+	}
+	return info
+}
+
+// IsProd reports whether the app runs in production
+func (c Config) IsProd() bool {
+	return c.Env == EnvProduction
+}
+
+// SecureCookies reports whether cookies should be limited to HTTPS,
+// which is the case in production or whenever the app serves TLS
+func (c Config) SecureCookies() bool {
+	return c.IsProd() || c.TLS.Enabled()
+}
+
+// Default returns the development configuration
+func Default() Config {
+	return Config{
+		Env:  EnvDevelopment,
+		Addr: ":3000",
+		Server: ServerConfig{
+			ReadHeaderTimeout: Duration{10 * time.Second},
+			ReadTimeout:       Duration{5 * time.Minute},
+			WriteTimeout:      Duration{5 * time.Minute},
+			IdleTimeout:       Duration{2 * time.Minute},
+			ShutdownTimeout:   Duration{30 * time.Second},
+		},
+		TLS: TLSConfig{
+			ReloadInterval: Duration{time.Minute},
+		},
+		Database: DatabaseConfig{
+			Driver:   DriverPostgres,
+			Host:     "localhost",
+			Port:     5432,
+			User:     "postgres",
+			Password: "qwerty",
+			Name:     "gophotos_dev",
+			SSLMode:  "disable",
+
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: Duration{30 * time.Minute},
+			ConnMaxIdleTime: Duration{5 * time.Minute},
+			SlowQuery:       Duration{200 * time.Millisecond},
+		},
+		Tracing: TracingConfig{
+			Exporter:    TraceNone,
+			SampleRatio: 1,
+		},
+		Cookie: CookieConfig{
+			Lifetime:        Duration{30 * 24 * time.Hour},
+			SessionLifetime: Duration{12 * time.Hour},
+			RefreshAfter:    Duration{time.Hour},
+		},
+		UserCache: UserCacheConfig{
+			// Off until asked for: see UserCacheConfig
+			Store: CacheNone,
+			Size:  10000,
+			TTL:   Duration{30 * time.Second},
+		},
+		HMACKey:        devHMACKey,
+		Pepper:         devPepper,
+		CSRFKey:        devCSRFKey,
+		CookieKey:      devCookieKey,
+		RateLimitStore: "memory",
+	}
+}
+
+// Load builds the configuration from the defaults, the config file,
+// the environment and the command-line flags in args (usually
+// os.Args[1:]), then validates it.
+func Load(args []string) (Config, error) {
+	fs := flag.NewFlagSet("gophotos", flag.ContinueOnError)
+	load := RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return Default(), err
+	}
+	return load()
+}
+
+// RegisterFlags adds the config flags to fs, so commands can mix them
+// with flags of their own. The returned function builds and validates
+// the config once fs has been parsed.
+func RegisterFlags(fs *flag.FlagSet) func() (Config, error) {
+	file := fs.String("config", DefaultFile, "path to a JSON config file")
+	env := fs.String("env", "", "environment: dev or prod")
+	addr := fs.String("addr", "", "address to listen on, e.g. :3000")
+	dbDriver := fs.String("db-driver", "", "database driver: postgres or sqlite3")
+	dbDSN := fs.String("db-dsn", "", "database connection string; a file path for sqlite3")
+	dbHost := fs.String("db-host", "", "database host")
+	dbPort := fs.Int("db-port", 0, "database port")
+	dbUser := fs.String("db-user", "", "database user")
+	dbName := fs.String("db-name", "", "database name")
+	devDir := fs.String("dev-dir", "", "source checkout to reload templates and assets from (dev only)")
+
+	return func() (Config, error) {
+		cfg := Default()
+
+		explicit := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+		if err := loadFile(&cfg, *file, explicit["config"]); err != nil {
+			return cfg, err
+		}
+		if err := loadEnv(&cfg); err != nil {
+			return cfg, err
+		}
+
+		// Flags win over everything else, but only if they were given
+		if explicit["env"] {
+			cfg.Env = *env
+		}
+		if explicit["addr"] {
+			cfg.Addr = *addr
+		}
+		if explicit["db-driver"] {
+			cfg.Database.Driver = *dbDriver
+		}
+		if explicit["db-dsn"] {
+			cfg.Database.DSN = *dbDSN
+		}
+		if explicit["db-host"] {
+			cfg.Database.Host = *dbHost
+		}
+		if explicit["db-port"] {
+			cfg.Database.Port = *dbPort
+		}
+		if explicit["db-user"] {
+			cfg.Database.User = *dbUser
+		}
+		if explicit["db-name"] {
+			cfg.Database.Name = *dbName
+		}
+		if explicit["dev-dir"] {
+			cfg.DevDir = *devDir
+		}
+
+		return cfg, cfg.Validate()
+	}
+}
+
+// loadFile reads path into cfg. Fields missing from the file keep
+// their current values. A missing file is only an error if it was
+// asked for explicitly.
+func loadFile(cfg *Config, path string, required bool) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("config: reading %s: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv applies GOPHOTOS_* environment variables to cfg
+func loadEnv(cfg *Config) error {
+	strs := map[string]*string{
+		"GOPHOTOS_ENV":                       &cfg.Env,
+		"GOPHOTOS_ADDR":                      &cfg.Addr,
+		"GOPHOTOS_DB_DRIVER":                 &cfg.Database.Driver,
+		"GOPHOTOS_DB_DSN":                    &cfg.Database.DSN,
+		"GOPHOTOS_DB_HOST":                   &cfg.Database.Host,
+		"GOPHOTOS_DB_USER":                   &cfg.Database.User,
+		"GOPHOTOS_DB_PASSWORD":               &cfg.Database.Password,
+		"GOPHOTOS_DB_NAME":                   &cfg.Database.Name,
+		"GOPHOTOS_DB_SSLMODE":                &cfg.Database.SSLMode,
+		"GOPHOTOS_DB_REPLICA_DSN":            &cfg.Database.ReplicaDSN,
+		"GOPHOTOS_DB_LOG_SQL":                &cfg.Database.LogSQL,
+		"GOPHOTOS_HMAC_KEY":                  &cfg.HMACKey,
+		"GOPHOTOS_PEPPER":                    &cfg.Pepper,
+		"GOPHOTOS_CSRF_KEY":                  &cfg.CSRFKey,
+		"GOPHOTOS_COOKIE_KEY":                &cfg.CookieKey,
+		"GOPHOTOS_RATE_LIMIT_STORE":          &cfg.RateLimitStore,
+		"GOPHOTOS_TLS_CERT_FILE":             &cfg.TLS.CertFile,
+		"GOPHOTOS_TLS_KEY_FILE":              &cfg.TLS.KeyFile,
+		"GOPHOTOS_TLS_REDIRECT_ADDR":         &cfg.TLS.RedirectAddr,
+		"GOPHOTOS_METRICS_ADDR":              &cfg.Metrics.Addr,
+		"GOPHOTOS_METRICS_USERNAME":          &cfg.Metrics.Username,
+		"GOPHOTOS_METRICS_PASSWORD":          &cfg.Metrics.Password,
+		"GOPHOTOS_TRACING_EXPORTER":          &cfg.Tracing.Exporter,
+		"GOPHOTOS_TRACING_FILE":              &cfg.Tracing.File,
+		"GOPHOTOS_DEV_DIR":                   &cfg.DevDir,
+		"GOPHOTOS_USER_CACHE_STORE":          &cfg.UserCache.Store,
+		"GOPHOTOS_USER_CACHE_MEMCACHED_ADDR": &cfg.UserCache.MemcachedAddr,
+	}
+	for name, dst := range strs {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+
+	ints := map[string]*int{
+		"GOPHOTOS_DB_PORT":           &cfg.Database.Port,
+		"GOPHOTOS_DB_MAX_OPEN_CONNS": &cfg.Database.MaxOpenConns,
+		"GOPHOTOS_DB_MAX_IDLE_CONNS": &cfg.Database.MaxIdleConns,
+		"GOPHOTOS_USER_CACHE_SIZE":   &cfg.UserCache.Size,
+	}
+	for name, dst := range ints {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: %s must be a number: %v", name, err)
+		}
+		*dst = n
+	}
+
+	floats := map[string]*float64{
+		"GOPHOTOS_TRACING_SAMPLE_RATIO": &cfg.Tracing.SampleRatio,
+	}
+	for name, dst := range floats {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("config: %s must be a number: %v", name, err)
+		}
+		*dst = f
+	}
+	return nil
+}
+
+// Validate checks that the configuration is usable. In production it
+// also requires every secret to be set to something other than the
+// development default.
+func (c Config) Validate() error {
+	var problems []string
+
+	switch c.Env {
+	case EnvDevelopment, EnvProduction:
+	default:
+		problems = append(problems, fmt.Sprintf("env must be %q or %q, got %q",
+			EnvDevelopment, EnvProduction, c.Env))
+	}
+	if len(c.CSRFKey) != 32 {
+		problems = append(problems, "csrf_key must be exactly 32 bytes long")
+	}
+	switch c.RateLimitStore {
+	case "memory", "database":
+	default:
+		problems = append(problems, fmt.Sprintf(
+			"rate_limit_store must be \"memory\" or \"database\", got %q", c.RateLimitStore))
+	}
+
+	switch c.Database.Driver {
+	case DriverPostgres:
+	case DriverSQLite:
+		if c.Database.DSN == "" {
+			problems = append(problems, "database.dsn is required for sqlite3")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("database.driver must be %q or %q, got %q",
+			DriverPostgres, DriverSQLite, c.Database.Driver))
+	}
+
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		problems = append(problems, "database.max_open_conns and database.max_idle_conns must not be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, "database.max_idle_conns must not exceed database.max_open_conns")
+	}
+	if c.Database.ConnMaxLifetime.Duration < 0 || c.Database.ConnMaxIdleTime.Duration < 0 {
+		problems = append(problems, "database.conn_max_lifetime and database.conn_max_idle_time must not be negative")
+	}
+	switch c.Database.LogSQL {
+	case "", LogSQLAll, LogSQLErrors:
+	case LogSQLSlow:
+		if c.Database.SlowQuery.Duration <= 0 {
+			problems = append(problems, "database.slow_query must be positive")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("database.log_sql must be %q, %q or %q, got %q",
+			LogSQLAll, LogSQLSlow, LogSQLErrors, c.Database.LogSQL))
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		problems = append(problems, "tls.cert_file and tls.key_file must be set together")
+	}
+	if c.TLS.RedirectAddr != "" && !c.TLS.Enabled() {
+		problems = append(problems, "tls.redirect_addr requires tls.cert_file and tls.key_file")
+	}
+	if c.TLS.Enabled() && c.TLS.ReloadInterval.Duration <= 0 {
+		problems = append(problems, "tls.reload_interval must be positive")
+	}
+
+	if (c.Metrics.Username == "") != (c.Metrics.Password == "") {
+		problems = append(problems, "metrics.username and metrics.password must be set together")
+	}
+	if c.Metrics.Addr != "" && c.Metrics.Addr == c.Addr {
+		problems = append(problems, "metrics.addr must differ from addr")
+	}
+
+	if c.Cookie.Lifetime.Duration <= 0 || c.Cookie.SessionLifetime.Duration <= 0 || c.Cookie.RefreshAfter.Duration <= 0 {
+		problems = append(problems, "cookie.lifetime, cookie.session_lifetime and cookie.refresh_after must be positive")
+	}
+	// A cookie must be refreshed before it expires, or users get
+	// signed out however active they are
+	if c.Cookie.RefreshAfter.Duration >= c.Cookie.SessionLifetime.Duration ||
+		c.Cookie.RefreshAfter.Duration >= c.Cookie.Lifetime.Duration {
+		problems = append(problems, "cookie.refresh_after must be shorter than cookie.session_lifetime and cookie.lifetime")
+	}
+
+	switch c.UserCache.Store {
+	case CacheNone:
+	case CacheMemory:
+		if c.UserCache.Size <= 0 {
+			problems = append(problems, "user_cache.size must be positive")
+		}
+	case CacheMemcached:
+		if c.UserCache.MemcachedAddr == "" {
+			problems = append(problems, "user_cache.memcached_addr is required for memcached")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("user_cache.store must be %q, %q or %q, got %q",
+			CacheNone, CacheMemory, CacheMemcached, c.UserCache.Store))
+	}
+	if c.UserCache.Store != CacheNone && c.UserCache.TTL.Duration <= 0 {
+		problems = append(problems, "user_cache.ttl must be positive")
+	}
+
+	switch c.Tracing.Exporter {
+	case TraceNone, TraceStderr:
+	case TraceFile:
+		if c.Tracing.File == "" {
+			problems = append(problems, "tracing.file is required for the file exporter")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter must be %q, %q or %q, got %q",
+			TraceNone, TraceStderr, TraceFile, c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sample_ratio must be between 0 and 1")
+	}
+
+	if c.IsProd() && c.DevDir != "" {
+		problems = append(problems, "dev_dir cannot be used in production")
+	}
+
+	if c.IsProd() {
+		secrets := []struct {
+			name, value, dev string
+		}{
+			{"hmac_key", c.HMACKey, devHMACKey},
+			{"pepper", c.Pepper, devPepper},
+			{"csrf_key", c.CSRFKey, devCSRFKey},
+			{"cookie_key", c.CookieKey, devCookieKey},
+		}
+		for _, s := range secrets {
+			if s.value == "" || s.value == s.dev {
+				problems = append(problems, s.name+" must be set in production")
+			}
+		}
+		// The database password may legitimately be empty (e.g. when
+		// using a client certificate), but never the development one.
+		usesPassword := c.Database.Driver == DriverPostgres && c.Database.DSN == ""
+		if usesPassword && c.Database.Password == Default().Database.Password {
+			problems = append(problems, "database.password must be changed in production")
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
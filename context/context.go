@@ -3,12 +3,17 @@ package context
 import (
 	"context"
 
+	"github.com/nahuakang/gophotos/logger"
 	"github.com/nahuakang/gophotos/models"
 )
 
 type privateKey string
 
-const userKey privateKey = "user"
+const (
+	userKey   privateKey = "user"
+	nonceKey  privateKey = "csp-nonce"
+	loggerKey privateKey = "logger"
+)
 
 // WithUser returns a context.Context with the user information
 func WithUser(ctx context.Context, user *models.User) context.Context {
@@ -25,3 +30,33 @@ func User(ctx context.Context) *models.User {
 	}
 	return nil
 }
+
+// WithCSPNonce returns a context.Context with the Content-Security-Policy
+// nonce generated for the current request
+func WithCSPNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, nonceKey, nonce)
+}
+
+// CSPNonce looks up the Content-Security-Policy nonce from a given
+// context.Context, returning "" if none was set
+func CSPNonce(ctx context.Context) string {
+	if nonce, ok := ctx.Value(nonceKey).(string); ok {
+		return nonce
+	}
+	return ""
+}
+
+// WithLogger returns a context.Context carrying the request's logger
+func WithLogger(ctx context.Context, lg *logger.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, lg)
+}
+
+// Logger looks up the request's logger from a given context.Context.
+// If none was stored, logger.Default() is returned so callers can
+// always log.
+func Logger(ctx context.Context) *logger.Logger {
+	if lg, ok := ctx.Value(loggerKey).(*logger.Logger); ok {
+		return lg
+	}
+	return logger.Default()
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/nahuakang/gophotos/context"
+	"github.com/nahuakang/gophotos/models"
+	"github.com/nahuakang/gophotos/policy"
+	"github.com/nahuakang/gophotos/views"
+)
+
+// NewAudit returns a new Audit controller
+func NewAudit(as models.AuditService) *Audit {
+	return &Audit{
+		IndexView:    views.NewView("bootstrap", "audit/index"),
+		ActivityView: views.NewView("bootstrap", "audit/activity"),
+		as:           as,
+	}
+}
+
+// Audit is the controller for viewing the audit log
+type Audit struct {
+	IndexView    *views.View
+	ActivityView *views.View
+	as           models.AuditService
+}
+
+// AuditFilterForm holds the filters of the admin audit log page
+type AuditFilterForm struct {
+	ActorID    uint   `schema:"actor_id"`
+	Action     string `schema:"action"`
+	TargetType string `schema:"target_type"`
+	TargetID   uint   `schema:"target_id"`
+}
+
+// Index shows the audit log, filtered by the query string, to admins
+//
+// GET /admin/audit
+func (a *Audit) Index(w http.ResponseWriter, r *http.Request) {
+	if !policy.IsAdmin(context.User(r.Context())) {
+		views.Forbidden(w, r)
+		return
+	}
+
+	var vd views.Data
+	var form AuditFilterForm
+	if err := parseQuery(r, &form); err != nil {
+		vd.SetAlert(err)
+		a.IndexView.Render(w, r, vd)
+		return
+	}
+
+	entries, err := a.as.List(models.AuditFilter{
+		ActorID:    form.ActorID,
+		Action:     form.Action,
+		TargetType: form.TargetType,
+		TargetID:   form.TargetID,
+	})
+	if err != nil {
+		vd.SetAlert(err)
+		a.IndexView.Render(w, r, vd)
+		return
+	}
+
+	vd.Yield = struct {
+		Filter  AuditFilterForm
+		Entries []models.AuditEntry
+	}{form, entries}
+	a.IndexView.Render(w, r, vd)
+}
+
+// Activity shows the signed in user's recent activity
+//
+// GET /account/activity
+func (a *Audit) Activity(w http.ResponseWriter, r *http.Request) {
+	var vd views.Data
+	user := context.User(r.Context())
+	entries, err := a.as.List(models.AuditFilter{
+		UserID: user.ID,
+		Limit:  25,
+	})
+	if err != nil {
+		vd.SetAlert(err)
+		a.ActivityView.Render(w, r, vd)
+		return
+	}
+
+	vd.Yield = entries
+	a.ActivityView.Render(w, r, vd)
+}
+
+// recordAudit fills in the actor and client details of entry from the
+// request and appends it to the audit log. Failing to record an entry
+// is logged but does not fail the request.
+func recordAudit(as models.AuditService, r *http.Request, entry models.AuditEntry) {
+	if user := context.User(r.Context()); user != nil && entry.ActorID == 0 {
+		entry.ActorID = user.ID
+	}
+	entry.IP = clientIP(r)
+	entry.UserAgent = r.UserAgent()
+
+	if err := as.Record(&entry); err != nil {
+		context.Logger(r.Context()).Error("recording audit entry",
+			"action", entry.Action,
+			"error", err,
+		)
+	}
+}
+
+// clientIP returns the IP address of the client making the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
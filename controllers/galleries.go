@@ -7,30 +7,41 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/nahuakang/gophotos/context"
 	"github.com/nahuakang/gophotos/models"
+	"github.com/nahuakang/gophotos/policy"
 	"github.com/nahuakang/gophotos/views"
 )
 
-// ShowGallery is the show galleries route
-const ShowGallery = "show_gallery"
+const (
+	// IndexGalleries is the route listing the current user's galleries
+	IndexGalleries = "index_galleries"
+	// ShowGallery is the show galleries route
+	ShowGallery = "show_gallery"
+	// EditGallery is the route of the edit gallery form
+	EditGallery = "edit_gallery"
+)
 
 // NewGalleries returns a new Galleries controller
-func NewGalleries(gs models.GalleryService, r *mux.Router) *Galleries {
+func NewGalleries(gs models.GalleryService, as models.AuditService, r *mux.Router) *Galleries {
 	return &Galleries{
-		New:      views.NewView("bootstrap", "galleries/new"),
-		ShowView: views.NewView("bootstrap", "galleries/show"),
-		EditView: views.NewView("bootstrap", "galleries/edit"),
-		gs:       gs,
-		router:   r,
+		New:       views.NewView("bootstrap", "galleries/new"),
+		ShowView:  views.NewView("bootstrap", "galleries/show"),
+		EditView:  views.NewView("bootstrap", "galleries/edit"),
+		IndexView: views.NewView("bootstrap", "galleries/index"),
+		gs:        gs,
+		as:        as,
+		router:    r,
 	}
 }
 
 // Galleries is the controller for galleries
 type Galleries struct {
-	New      *views.View
-	ShowView *views.View
-	EditView *views.View
-	gs       models.GalleryService
-	router   *mux.Router
+	New       *views.View
+	ShowView  *views.View
+	EditView  *views.View
+	IndexView *views.View
+	gs        models.GalleryService
+	as        models.AuditService
+	router    *mux.Router
 }
 
 // GalleryForm represents a form for new gallery
@@ -38,36 +49,59 @@ type GalleryForm struct {
 	Title string `schema:"title"`
 }
 
+// Index lists the galleries owned by the current user
+//
+// GET /galleries
+func (g *Galleries) Index(w http.ResponseWriter, r *http.Request) {
+	var vd views.Data
+	user := context.User(r.Context())
+	galleries, err := g.gs.WithContext(r.Context()).ByUserID(user.ID)
+	if err != nil {
+		vd.SetAlert(err)
+		g.IndexView.Render(w, r, vd)
+		return
+	}
+
+	vd.Yield = galleries
+	g.IndexView.Render(w, r, vd)
+}
+
 // Create handles POST requests for galleries
 func (g *Galleries) Create(w http.ResponseWriter, r *http.Request) {
 	var vd views.Data
 	var form GalleryForm
 
-	if err := parseForm(r, &form); err != nil {
+	err := parseForm(r, &form)
+	vd.Yield = form
+	if err != nil {
 		vd.SetAlert(err)
-		g.New.Render(w, vd)
+		g.New.Render(w, r, vd)
 		return
 	}
 
 	user := context.User(r.Context())
+	if !policy.CanCreate(user) {
+		views.Forbidden(w, r)
+		return
+	}
+
 	gallery := models.Gallery{
 		Title:  form.Title,
 		UserID: user.ID,
 	}
 
-	if err := g.gs.Create(&gallery); err != nil {
+	if err := g.gs.WithContext(r.Context()).Create(&gallery); err != nil {
 		vd.SetAlert(err)
-		g.New.Render(w, vd)
-		return
-	}
-
-	url, err := g.router.Get(ShowGallery).URL("id", strconv.Itoa(int(gallery.ID)))
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusFound)
+		g.New.Render(w, r, vd)
 		return
 	}
+	galleriesCreatedTotal.Inc()
+	g.audit(r, models.AuditGalleryCreate, &gallery, nil)
 
-	http.Redirect(w, r, url.Path, http.StatusFound)
+	g.redirect(w, r, ShowGallery, &gallery, views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Gallery successfully created!",
+	})
 }
 
 // Show handles GET /galleries/:id requests
@@ -77,46 +111,173 @@ func (g *Galleries) Show(w http.ResponseWriter, r *http.Request) {
 		return // galleryByID already handled the errors
 	}
 
+	user := context.User(r.Context())
+	if !policy.CanView(user, gallery) {
+		views.NotFound(w, r)
+		return
+	}
+
 	var vd views.Data
 	vd.Yield = gallery
-	g.ShowView.Render(w, vd)
+	g.ShowView.Render(w, r, vd)
 }
 
 // Edit handles GET /galleries/:id/edit requests
 func (g *Galleries) Edit(w http.ResponseWriter, r *http.Request) {
-	gallery, err := g.galleryByID(w, r)
+	gallery, err := g.galleryByIDPrimary(w, r)
 	if err != nil {
-		return // galleryByID already handled the errors
+		return // galleryByIDPrimary already handled the errors
+	}
+
+	user := context.User(r.Context())
+	if !policy.CanEdit(user, gallery) {
+		views.Forbidden(w, r)
+		return
+	}
+
+	var vd views.Data
+	vd.Yield = gallery
+	g.EditView.Render(w, r, vd)
+}
+
+// Update handles the edit gallery form
+//
+// POST /galleries/:id/update
+func (g *Galleries) Update(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByIDPrimary(w, r)
+	if err != nil {
+		return // galleryByIDPrimary already handled the errors
 	}
 
 	user := context.User(r.Context())
-	if gallery.UserID != user.ID {
-		http.Error(w, "You do not have permission to edit "+
-			"this gallery", http.StatusForbidden)
+	if !policy.CanEdit(user, gallery) {
+		views.Forbidden(w, r)
 		return
 	}
 
 	var vd views.Data
 	vd.Yield = gallery
-	g.EditView.Render(w, vd)
+	var form GalleryForm
+	if err := parseForm(r, &form); err != nil {
+		vd.SetAlert(err)
+		g.EditView.Render(w, r, vd)
+		return
+	}
+
+	changes := map[string]models.Change{}
+	if form.Title != gallery.Title {
+		changes["title"] = models.Change{From: gallery.Title, To: form.Title}
+	}
+	gallery.Title = form.Title
+	if err := g.gs.WithContext(r.Context()).Update(gallery); err != nil {
+		vd.SetAlert(err)
+		g.EditView.Render(w, r, vd)
+		return
+	}
+	g.audit(r, models.AuditGalleryUpdate, gallery, changes)
+
+	g.redirect(w, r, EditGallery, gallery, views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Gallery successfully updated!",
+	})
 }
 
+// Delete deletes a gallery and sends the user back to their galleries
+//
+// POST /galleries/:id/delete
+func (g *Galleries) Delete(w http.ResponseWriter, r *http.Request) {
+	gallery, err := g.galleryByIDPrimary(w, r)
+	if err != nil {
+		return // galleryByIDPrimary already handled the errors
+	}
+
+	user := context.User(r.Context())
+	if !policy.CanDelete(user, gallery) {
+		views.Forbidden(w, r)
+		return
+	}
+
+	if err := g.gs.WithContext(r.Context()).Delete(gallery.ID); err != nil {
+		var vd views.Data
+		vd.SetAlert(err)
+		vd.Yield = gallery
+		g.EditView.Render(w, r, vd)
+		return
+	}
+	g.audit(r, models.AuditGalleryDelete, gallery, map[string]models.Change{
+		"title":   {From: gallery.Title},
+		"user_id": {From: gallery.UserID},
+	})
+
+	g.redirect(w, r, IndexGalleries, nil, views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Gallery successfully deleted!",
+	})
+}
+
+// redirect sends the user to the named route, for gallery if the route
+// takes an ID, with alert shown there. If the route cannot be built
+// they are sent home instead.
+func (g *Galleries) redirect(w http.ResponseWriter, r *http.Request, route string, gallery *models.Gallery, alert views.Alert) {
+	var pairs []string
+	if gallery != nil {
+		pairs = []string{"id", strconv.Itoa(int(gallery.ID))}
+	}
+	url, err := g.router.Get(route).URL(pairs...)
+	if err != nil {
+		views.RedirectAlert(w, r, "/", http.StatusFound, alert)
+		return
+	}
+	views.RedirectAlert(w, r, url.Path, http.StatusFound, alert)
+}
+
+// audit records action on gallery, flagging it as an admin action if
+// the signed in user does not own the gallery
+func (g *Galleries) audit(r *http.Request, action string, gallery *models.Gallery, changes map[string]models.Change) {
+	user := context.User(r.Context())
+	entry := models.AuditEntry{
+		Action:     action,
+		TargetType: models.AuditTargetGallery,
+		TargetID:   gallery.ID,
+		Admin:      user != nil && user.ID != gallery.UserID,
+	}
+	entry.SetChanges(changes)
+	recordAudit(g.as, r, entry)
+}
+
+// galleryByID looks up the gallery in the route, which may come from
+// a replica. It is only for pages that show the gallery to anyone.
 func (g *Galleries) galleryByID(w http.ResponseWriter, r *http.Request) (*models.Gallery, error) {
+	return g.lookupGallery(w, r, g.gs.WithContext(r.Context()).ByID)
+}
+
+// galleryByIDPrimary looks up the gallery in the route on the primary
+// database. A replica that lags behind would check permissions against
+// an old owner, and Update would save its stale row over recent
+// changes.
+func (g *Galleries) galleryByIDPrimary(w http.ResponseWriter, r *http.Request) (*models.Gallery, error) {
+	return g.lookupGallery(w, r, g.gs.WithContext(r.Context()).ByIDPrimary)
+}
+
+// lookupGallery looks up the gallery in the route with byID, rendering
+// the error page if that fails
+func (g *Galleries) lookupGallery(w http.ResponseWriter, r *http.Request, byID func(uint) (*models.Gallery, error)) (*models.Gallery, error) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid gallery ID", http.StatusNotFound)
+		views.NotFound(w, r)
 		return nil, err
 	}
 
-	gallery, err := g.gs.ByID(uint(id))
+	gallery, err := byID(uint(id))
 	if err != nil {
 		switch err {
 		case models.ErrNotFound:
-			http.Error(w, "Gallery not found", http.StatusNotFound)
+			views.NotFound(w, r)
 		default:
-			http.Error(w, "Whoops! Something went wrong", http.StatusInternalServerError)
+			context.Logger(r.Context()).Error("looking up gallery", "gallery_id", id, "error", err)
+			views.InternalServerError(w, r)
 		}
 		return nil, err
 	}
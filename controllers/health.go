@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// readyTimeout bounds how long all readiness checks may take together
+const readyTimeout = 3 * time.Second
+
+// Check is a named readiness check. Fn returns nil when the
+// dependency it checks is usable.
+type Check struct {
+	Name string
+	Fn   func(ctx context.Context) error
+}
+
+// NewHealth returns a controller for the orchestrator probes. checks
+// are run on every readiness probe.
+func NewHealth(checks ...Check) *Health {
+	return &Health{
+		checks: checks,
+		build:  readBuildInfo(),
+	}
+}
+
+// Health answers liveness, readiness and version probes. Its handlers
+// write JSON and are meant to be mounted outside of the session,
+// CSRF and logging middleware.
+type Health struct {
+	checks []Check
+	build  buildInfo
+}
+
+// Healthz answers 200 as long as the process can serve requests
+//
+// GET /healthz
+func (h *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz runs every check and answers 200 if they all pass, or 503
+// with the failures otherwise
+//
+// GET /readyz
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	results := make(map[string]string, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func(c Check) {
+			defer wg.Done()
+			result := "ok"
+			if err := c.Fn(ctx); err != nil {
+				result = err.Error()
+			}
+			mu.Lock()
+			results[c.Name] = result
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	for _, result := range results {
+		if result != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status": status,
+		"checks": results,
+	})
+}
+
+// Version describes the running build
+//
+// GET /version
+func (h *Health) Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.build)
+}
+
+// buildInfo is the body of the /version response
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// readBuildInfo reads the module version and the VCS details that the
+// go command stamps into binaries built from a checkout
+func readBuildInfo() buildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return buildInfo{Version: "unknown"}
+	}
+	b := buildInfo{
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Commit = s.Value
+		case "vcs.time":
+			b.BuildTime = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/gorilla/schema"
 )
@@ -11,8 +12,20 @@ func parseForm(r *http.Request, dst interface{}) error {
 		return err
 	}
 
+	return parseValues(r.PostForm, dst)
+}
+
+// parseQuery decodes the URL query string, e.g. for filter forms
+// submitted with GET
+func parseQuery(r *http.Request, dst interface{}) error {
+	return parseValues(r.URL.Query(), dst)
+}
+
+func parseValues(values url.Values, dst interface{}) error {
 	decoder := schema.NewDecoder()
-	if err := decoder.Decode(dst, r.PostForm); err != nil {
+	// Ignore fields such as the CSRF token that are not part of dst
+	decoder.IgnoreUnknownKeys(true)
+	if err := decoder.Decode(dst, values); err != nil {
 		return err
 	}
 
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/nahuakang/gophotos/metrics"
+)
+
+// Results of a login attempt, used as the result label of loginsTotal
+const (
+	loginSuccess = "success"
+	loginFailure = "failure"
+	loginLockout = "lockout"
+)
+
+var (
+	signupsTotal = metrics.NewCounter(
+		"gophotos_signups_total",
+		"Accounts created through the signup form.",
+	)
+	loginsTotal = metrics.NewCounterVec(
+		"gophotos_logins_total",
+		"Login attempts by result: success, failure, or lockout when the login rate limit turned the attempt away.",
+		"result",
+	)
+	galleriesCreatedTotal = metrics.NewCounter(
+		"gophotos_galleries_created_total",
+		"Galleries created.",
+	)
+)
+
+func init() {
+	metrics.Register(signupsTotal, loginsTotal, galleriesCreatedTotal)
+}
+
+// LoginLockedOut counts a login attempt that was turned away by a rate
+// limit. Use it as the OnLimit hook of the login rate limit.
+func (u *Users) LoginLockedOut(r *http.Request) {
+	loginsTotal.With(loginLockout).Inc()
+}
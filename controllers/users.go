@@ -4,17 +4,21 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/nahuakang/gophotos/context"
+	"github.com/nahuakang/gophotos/cookie"
 	"github.com/nahuakang/gophotos/models"
 	"github.com/nahuakang/gophotos/rand"
 	"github.com/nahuakang/gophotos/views"
 )
 
 // NewUsers creates a new Users
-func NewUsers(us models.UserService) *Users {
+func NewUsers(us models.UserService, as models.AuditService, cp *cookie.Policy) *Users {
 	return &Users{
 		NewView:   views.NewView("bootstrap", "users/new"),
 		LoginView: views.NewView("bootstrap", "users/login"),
 		us:        us,
+		as:        as,
+		cp:        cp,
 	}
 }
 
@@ -23,18 +27,22 @@ type Users struct {
 	NewView   *views.View
 	LoginView *views.View
 	us        models.UserService
+	as        models.AuditService
+	cp        *cookie.Policy
 }
 
-// LoginForm contains email and password
+// LoginForm contains email and password, and whether the user
+// wants to stay signed in after closing the browser
 type LoginForm struct {
 	Email    string `schema:"email"`
 	Password string `schema:"password"`
+	Remember bool   `schema:"remember_me"`
 }
 
 // New renders the form where a user creates a new user account
 // GET /signup
 func (u *Users) New(w http.ResponseWriter, r *http.Request) {
-	u.NewView.Render(w, nil)
+	u.NewView.Render(w, r, nil)
 }
 
 // Create propcesses the signup form when a user creates a new user account
@@ -44,9 +52,13 @@ func (u *Users) Create(w http.ResponseWriter, r *http.Request) {
 	// Parse the submitted form
 	var form SignupForm // Initialized to fields' zero values
 
-	if err := parseForm(r, &form); err != nil {
+	err := parseForm(r, &form)
+	// Fill the form back in if it has to be shown again, but never
+	// with the password
+	vd.Yield = SignupForm{Name: form.Name, Email: form.Email}
+	if err != nil {
 		vd.SetAlert(err)
-		u.NewView.Render(w, vd)
+		u.NewView.Render(w, r, vd)
 		return
 	}
 
@@ -55,19 +67,32 @@ func (u *Users) Create(w http.ResponseWriter, r *http.Request) {
 		Email:    form.Email,
 		Password: form.Password,
 	}
-	if err := u.us.Create(&user); err != nil {
+	if err := u.us.WithContext(r.Context()).Create(&user); err != nil {
 		vd.SetAlert(err)
-		u.NewView.Render(w, vd)
+		u.NewView.Render(w, r, vd)
 		return
 	}
+	signupsTotal.Inc()
+
+	recordAudit(u.as, r, models.AuditEntry{
+		ActorID:    user.ID,
+		Action:     models.AuditUserCreate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+	})
 
-	err := u.signIn(w, &user)
+	err = u.signIn(w, r, &user, false)
 	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
+		views.RedirectAlert(w, r, "/login", http.StatusFound, views.Alert{
+			Level:   views.AlertLvlInfo,
+			Message: "Your account has been created. Please log in.",
+		})
 		return
 	}
-	// Redirect to the cookie test page to test the cookie
-	http.Redirect(w, r, "/cookietest", http.StatusFound)
+	views.RedirectAlert(w, r, "/galleries", http.StatusFound, views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Welcome to GoPhotos!",
+	})
 }
 
 // Login processes the login form when a user logs in as existing user
@@ -76,67 +101,124 @@ func (u *Users) Create(w http.ResponseWriter, r *http.Request) {
 func (u *Users) Login(w http.ResponseWriter, r *http.Request) {
 	var vd views.Data
 	var form LoginForm
-	if err := parseForm(r, &form); err != nil {
+	err := parseForm(r, &form)
+	vd.Yield = LoginForm{Email: form.Email, Remember: form.Remember}
+	if err != nil {
 		vd.SetAlert(err)
-		u.LoginView.Render(w, vd)
+		u.LoginView.Render(w, r, vd)
 		return
 	}
 
-	user, err := u.us.Authenticate(form.Email, form.Password)
+	user, err := u.us.WithContext(r.Context()).Authenticate(form.Email, form.Password)
 	if err != nil {
+		loginsTotal.With(loginFailure).Inc()
+		entry := models.AuditEntry{
+			Action:     models.AuditUserLoginFailed,
+			TargetType: models.AuditTargetUser,
+			Note:       form.Email,
+		}
+		// Let the owner of the account see attempts on it
+		if err == models.ErrPasswordIncorrect {
+			if target, err := u.us.WithContext(r.Context()).ByEmail(form.Email); err == nil {
+				entry.TargetID = target.ID
+			}
+		}
+		recordAudit(u.as, r, entry)
 		switch err {
 		case models.ErrNotFound:
-			vd.AlertError("No user exists with that email address")
+			vd.AlertFieldError("email", "No user exists with that email address")
+		case models.ErrPasswordIncorrect:
+			vd.AlertFieldError("password", models.ErrPasswordIncorrect.Public())
 		default:
 			vd.SetAlert(err)
 		}
-		u.LoginView.Render(w, vd)
+		u.LoginView.Render(w, r, vd)
 		return
 	}
 
-	err = u.signIn(w, user) // user is a pointer already
+	loginsTotal.With(loginSuccess).Inc()
+	recordAudit(u.as, r, models.AuditEntry{
+		ActorID:    user.ID,
+		Action:     models.AuditUserLogin,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+	})
+
+	err = u.signIn(w, r, user, form.Remember) // user is a pointer already
 	if err != nil {
 		vd.SetAlert(err)
-		u.LoginView.Render(w, vd)
+		u.LoginView.Render(w, r, vd)
+		return
+	}
+	views.RedirectAlert(w, r, "/galleries", http.StatusFound, views.Alert{
+		Level:   views.AlertLvlSuccess,
+		Message: "Welcome back!",
+	})
+}
+
+// Logout deletes the user's session cookie and rotates their remember
+// token so any copies of the old cookie stop working.
+//
+// POST /logout
+func (u *Users) Logout(w http.ResponseWriter, r *http.Request) {
+	user := context.User(r.Context())
+	token, err := rand.RememberToken()
+	if err != nil {
+		context.Logger(r.Context()).Error("generating remember token", "user_id", user.ID, "error", err)
+		views.InternalServerError(w, r)
 		return
 	}
-	http.Redirect(w, r, "/cookietest", http.StatusFound)
+	user.Remember = token
+	if err := u.us.WithContext(r.Context()).Update(user); err != nil {
+		// The old token still works, so the user is not logged out
+		context.Logger(r.Context()).Error("rotating remember token", "user_id", user.ID, "error", err)
+		views.InternalServerError(w, r)
+		return
+	}
+
+	u.cp.Clear(w)
+	recordAudit(u.as, r, models.AuditEntry{
+		Action:     models.AuditUserLogout,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+	})
+	views.RedirectAlert(w, r, "/", http.StatusFound, views.Alert{
+		Level:   views.AlertLvlInfo,
+		Message: "You have been logged out.",
+	})
 }
 
-// signIn signs in the given user via cookies
-func (u *Users) signIn(w http.ResponseWriter, user *models.User) error {
+// signIn signs in the given user via cookies. Persistent cookies
+// keep the user signed in after the browser is closed.
+func (u *Users) signIn(w http.ResponseWriter, r *http.Request, user *models.User, persistent bool) error {
 	if user.Remember == "" {
 		token, err := rand.RememberToken()
 		if err != nil {
 			return err
 		}
 		user.Remember = token
-		err = u.us.Update(user)
+		err = u.us.WithContext(r.Context()).Update(user)
 		if err != nil {
 			return err
 		}
 	}
 
-	cookie := http.Cookie{
-		Name:     "remember_token",
-		Value:    user.Remember,
-		HttpOnly: true,
-	}
-	http.SetCookie(w, &cookie)
+	u.cp.Set(w, user.Remember, persistent)
 	return nil
 }
 
 // CookieTest is used to display cookies set on the current user
 func (u *Users) CookieTest(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("remember_token")
+	rem, err := u.cp.Read(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Redirect(w, r, "/login", http.StatusFound)
 		return
 	}
 
-	user, err := u.us.ByRemember(cookie.Value)
+	user, err := u.us.WithContext(r.Context()).ByRemember(rem.Token)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		context.Logger(r.Context()).Error("looking up remember token", "error", err)
+		views.InternalServerError(w, r)
 		return
 	}
 	fmt.Fprintln(w, user)
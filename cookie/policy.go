@@ -0,0 +1,176 @@
+// Package cookie decides how the remember_token cookie that keeps
+// users signed in is written and read: its flags, how long it lives
+// and when it is renewed.
+//
+// The cookie value is signed and records when it was issued, so
+// the server enforces the lifetime itself instead of trusting the
+// browser to expire the cookie:
+//
+//	<remember token>|<issued at, unix seconds>|<persistent 0/1>|<signature>
+package cookie
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nahuakang/gophotos/hash"
+)
+
+// RememberName is the name of the cookie holding the remember token
+const RememberName = "remember_token"
+
+var (
+	// ErrNoCookie is returned by Read when the request has no
+	// remember cookie.
+	ErrNoCookie = errors.New("cookie: no remember cookie")
+
+	// ErrInvalid is returned by Read when the cookie was not signed
+	// by this server or is malformed.
+	ErrInvalid = errors.New("cookie: invalid remember cookie")
+
+	// ErrExpired is returned by Read when the cookie is older than
+	// the policy allows.
+	ErrExpired = errors.New("cookie: remember cookie has expired")
+)
+
+// NewPolicy returns a Policy signing cookies with key. Secure cookies
+// are only sent over HTTPS, and should be used in production. See
+// Policy for the meaning of the durations; refreshAfter should be
+// shorter than both lifetimes.
+func NewPolicy(key string, secure bool, lifetime, sessionLifetime, refreshAfter time.Duration) *Policy {
+	return &Policy{
+		Lifetime:        lifetime,
+		SessionLifetime: sessionLifetime,
+		RefreshAfter:    refreshAfter,
+		Secure:          secure,
+		SameSite:        http.SameSiteLaxMode,
+		hmac:            hash.NewHMAC(key),
+	}
+}
+
+// Policy controls the remember cookie
+type Policy struct {
+	// Lifetime is how long a persistent ("remember me") cookie stays
+	// valid without being refreshed.
+	Lifetime time.Duration
+	// SessionLifetime is how long a session cookie, which the browser
+	// drops when it closes, stays valid without being refreshed.
+	SessionLifetime time.Duration
+	// RefreshAfter is how old a cookie has to be before Refresh
+	// issues a new one. Refreshing on use gives sliding expiration:
+	// only idle users get signed out.
+	RefreshAfter time.Duration
+	// Secure limits the cookie to HTTPS.
+	Secure bool
+	// SameSite limits sending the cookie on cross-site requests.
+	SameSite http.SameSite
+
+	hmac hash.HMAC
+}
+
+// Remember is the content of a valid remember cookie
+type Remember struct {
+	Token      string
+	IssuedAt   time.Time
+	Persistent bool
+}
+
+// Set writes a remember cookie for token issued now. A persistent
+// cookie survives the browser being closed; otherwise a session
+// cookie is used.
+func (p *Policy) Set(w http.ResponseWriter, token string, persistent bool) {
+	p.set(w, Remember{
+		Token:      token,
+		IssuedAt:   time.Now(),
+		Persistent: persistent,
+	})
+}
+
+// Read returns the remember cookie sent with r. It returns ErrNoCookie,
+// ErrInvalid or ErrExpired if there is no usable cookie.
+func (p *Policy) Read(r *http.Request) (*Remember, error) {
+	c, err := r.Cookie(RememberName)
+	if err != nil {
+		return nil, ErrNoCookie
+	}
+
+	parts := strings.Split(c.Value, "|")
+	if len(parts) != 4 {
+		return nil, ErrInvalid
+	}
+	payload := strings.Join(parts[:3], "|")
+	if !p.hmac.Equal(payload, parts[3]) {
+		return nil, ErrInvalid
+	}
+
+	issued, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	rem := Remember{
+		Token:      parts[0],
+		IssuedAt:   time.Unix(issued, 0),
+		Persistent: parts[2] == "1",
+	}
+	if time.Since(rem.IssuedAt) > p.lifetime(rem.Persistent) {
+		return nil, ErrExpired
+	}
+	return &rem, nil
+}
+
+// Refresh re-issues rem if it is older than RefreshAfter, extending
+// its lifetime.
+func (p *Policy) Refresh(w http.ResponseWriter, rem *Remember) {
+	if time.Since(rem.IssuedAt) < p.RefreshAfter {
+		return
+	}
+	p.Set(w, rem.Token, rem.Persistent)
+}
+
+// Clear deletes the remember cookie
+func (p *Policy) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RememberName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Secure:   p.Secure,
+		SameSite: p.SameSite,
+	})
+}
+
+func (p *Policy) set(w http.ResponseWriter, rem Remember) {
+	persistent := "0"
+	if rem.Persistent {
+		persistent = "1"
+	}
+	payload := rem.Token + "|" +
+		strconv.FormatInt(rem.IssuedAt.Unix(), 10) + "|" +
+		persistent
+
+	c := http.Cookie{
+		Name:     RememberName,
+		Value:    payload + "|" + p.hmac.Hash(payload),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   p.Secure,
+		SameSite: p.SameSite,
+	}
+	if rem.Persistent {
+		c.Expires = rem.IssuedAt.Add(p.Lifetime)
+		c.MaxAge = int(p.Lifetime.Seconds())
+	}
+	http.SetCookie(w, &c)
+}
+
+func (p *Policy) lifetime(persistent bool) time.Duration {
+	if persistent {
+		return p.Lifetime
+	}
+	return p.SessionLifetime
+}
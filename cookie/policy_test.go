@@ -0,0 +1,163 @@
+package cookie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestPolicy() *Policy {
+	return NewPolicy("test-cookie-key", true, 30*24*time.Hour, 12*time.Hour, time.Hour)
+}
+
+// issue returns the remember cookie p writes for rem
+func issue(t *testing.T, p *Policy, rem Remember) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	p.set(w, rem)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("set() wrote %d cookies, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+func read(p *Policy, c *http.Cookie) (*Remember, error) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if c != nil {
+		r.AddCookie(c)
+	}
+	return p.Read(r)
+}
+
+func TestSetRead(t *testing.T) {
+	p := newTestPolicy()
+	for _, persistent := range []bool{true, false} {
+		w := httptest.NewRecorder()
+		p.Set(w, "remember-token", persistent)
+		c := w.Result().Cookies()[0]
+
+		if c.Name != RememberName || !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+			t.Errorf("cookie = %+v, want an HttpOnly, Secure, SameSite=Lax %s cookie", c, RememberName)
+		}
+		if (c.MaxAge > 0) != persistent {
+			t.Errorf("persistent = %v: MaxAge = %d, want a MaxAge only for persistent cookies", persistent, c.MaxAge)
+		}
+
+		rem, err := read(p, c)
+		if err != nil {
+			t.Fatalf("Read() err = %v, want nil", err)
+		}
+		if rem.Token != "remember-token" || rem.Persistent != persistent {
+			t.Errorf("Read() = %+v, want token remember-token, persistent %v", rem, persistent)
+		}
+	}
+}
+
+func TestReadExpired(t *testing.T) {
+	p := newTestPolicy()
+	now := time.Now()
+	tests := []struct {
+		name string
+		rem  Remember
+		want error
+	}{
+		{"persistent within lifetime", Remember{Token: "t", IssuedAt: now.Add(-29 * 24 * time.Hour), Persistent: true}, nil},
+		{"persistent past lifetime", Remember{Token: "t", IssuedAt: now.Add(-31 * 24 * time.Hour), Persistent: true}, ErrExpired},
+		{"session within lifetime", Remember{Token: "t", IssuedAt: now.Add(-11 * time.Hour)}, nil},
+		{"session past lifetime", Remember{Token: "t", IssuedAt: now.Add(-13 * time.Hour)}, ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := read(p, issue(t, p, tt.rem)); err != tt.want {
+				t.Errorf("Read() err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	p := newTestPolicy()
+	valid := issue(t, p, Remember{Token: "remember-token", IssuedAt: time.Now(), Persistent: true})
+	parts := strings.Split(valid.Value, "|")
+	tamper := func(i int, v string) string {
+		changed := append([]string(nil), parts...)
+		changed[i] = v
+		return strings.Join(changed, "|")
+	}
+	other := NewPolicy("another-key", true, time.Hour, time.Hour, time.Minute)
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"changed token", tamper(0, "someone-elses-token")},
+		// A later issue time would extend the cookie's life
+		{"changed issue time", tamper(1, "99999999999")},
+		{"changed persistence", tamper(2, "0")},
+		{"changed signature", tamper(3, "c2lnbmF0dXJl")},
+		{"unsigned", strings.Join(parts[:3], "|")},
+		{"signed with another key", issue(t, other, Remember{Token: "remember-token", IssuedAt: time.Now()}).Value},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &http.Cookie{Name: RememberName, Value: tt.value}
+			if rem, err := read(p, c); err != ErrInvalid {
+				t.Errorf("Read() = %+v, %v, want %v", rem, err, ErrInvalid)
+			}
+		})
+	}
+
+	if _, err := read(p, nil); err != ErrNoCookie {
+		t.Errorf("Read() without a cookie err = %v, want %v", err, ErrNoCookie)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	p := newTestPolicy()
+	tests := []struct {
+		name        string
+		age         time.Duration
+		wantRefresh bool
+	}{
+		{"fresh", 10 * time.Minute, false},
+		{"old", 2 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rem := &Remember{Token: "remember-token", IssuedAt: time.Now().Add(-tt.age)}
+			w := httptest.NewRecorder()
+			p.Refresh(w, rem)
+
+			cookies := w.Result().Cookies()
+			if got := len(cookies) == 1; got != tt.wantRefresh {
+				t.Fatalf("Refresh() wrote %d cookies, want refreshed = %v", len(cookies), tt.wantRefresh)
+			}
+			if !tt.wantRefresh {
+				return
+			}
+			refreshed, err := read(p, cookies[0])
+			if err != nil {
+				t.Fatalf("Read() of the refreshed cookie err = %v, want nil", err)
+			}
+			if refreshed.Token != rem.Token || refreshed.Persistent != rem.Persistent {
+				t.Errorf("refreshed = %+v, want the token and persistence of %+v", refreshed, rem)
+			}
+			if !refreshed.IssuedAt.After(rem.IssuedAt) {
+				t.Errorf("refreshed IssuedAt = %v, want later than %v", refreshed.IssuedAt, rem.IssuedAt)
+			}
+		})
+	}
+}
+
+func TestClear(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestPolicy().Clear(w)
+	c := w.Result().Cookies()[0]
+	if c.Name != RememberName || c.Value != "" || c.MaxAge >= 0 {
+		t.Errorf("Clear() cookie = %+v, want an empty %s cookie with a negative MaxAge", c, RememberName)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nahuakang/gophotos/config"
+	"github.com/nahuakang/gophotos/logger"
+)
+
+const dbUsage = `usage: gophotos db reset [-yes] [flags]
+
+  reset    drop every table, including the audit log, and run all
+           migrations again. Refused in production.`
+
+// db runs the db command
+func db(args []string, lg *logger.Logger) error {
+	if len(args) == 0 || args[0] != "reset" {
+		return errors.New(dbUsage)
+	}
+
+	fs := newFlagSet("db reset", "db reset [-yes] [flags]")
+	yes := fs.Bool("yes", false, "skip the confirmation prompt")
+	cfg, err := parseFlags(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if cfg.IsProd() {
+		return errors.New("db reset: refusing to reset a production database")
+	}
+
+	name := cfg.Database.Name
+	if cfg.Database.Driver == config.DriverSQLite {
+		name = cfg.Database.DSN
+	}
+	if !*yes {
+		question := fmt.Sprintf("This deletes ALL data in database %q.\nType the database name to continue: ", name)
+		if !confirm(os.Stdin, question, name) {
+			return errors.New("db reset: aborted")
+		}
+	}
+
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	if err := services.DestructiveReset(); err != nil {
+		return err
+	}
+	fmt.Printf("database %q has been reset\n", name)
+	return nil
+}
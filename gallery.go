@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nahuakang/gophotos/logger"
+	"github.com/nahuakang/gophotos/models"
+)
+
+const galleryUsage = `usage: gophotos gallery <list|transfer-owner> [arguments] [flags]
+
+  list [-user ID]
+               list every gallery, or only those of one user
+  transfer-owner ID -to USER_ID
+               give a gallery to another user`
+
+// gallery runs the gallery command
+func gallery(args []string, lg *logger.Logger) error {
+	if len(args) == 0 {
+		return errors.New(galleryUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		return galleryList(args[1:], lg)
+	case "transfer-owner":
+		return galleryTransferOwner(args[1:], lg)
+	default:
+		return errors.New(galleryUsage)
+	}
+}
+
+func galleryList(args []string, lg *logger.Logger) error {
+	fs := newFlagSet("gallery list", "gallery list [-user ID] [flags]")
+	userID := fs.Uint("user", 0, "only list the galleries of this user")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	var galleries []models.Gallery
+	if *userID > 0 {
+		galleries, err = services.Gallery.ByUserID(*userID)
+	} else {
+		galleries, err = services.Gallery.All()
+	}
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tOWNER\tTITLE\tCREATED AT")
+	for _, g := range galleries {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n",
+			g.ID, g.UserID, g.Title, g.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	}
+	return tw.Flush()
+}
+
+func galleryTransferOwner(args []string, lg *logger.Logger) error {
+	fs := newFlagSet("gallery transfer-owner", "gallery transfer-owner ID -to USER_ID [flags]")
+	to := fs.Uint("to", 0, "ID of the new owner (required)")
+	cfg, id, err := parseFlagsWithID(fs, args)
+	if err != nil {
+		return err
+	}
+	if *to == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	g, err := services.Gallery.ByIDPrimary(id)
+	if err != nil {
+		return fmt.Errorf("gallery %d: %v", id, err)
+	}
+	owner, err := services.User.ByIDPrimary(*to)
+	if err != nil {
+		return fmt.Errorf("user %d: %v", *to, err)
+	}
+	if g.UserID == owner.ID {
+		fmt.Printf("gallery %d already belongs to user %d\n", g.ID, owner.ID)
+		return nil
+	}
+
+	from := g.UserID
+	g.UserID = owner.ID
+	if err := services.Gallery.Update(g); err != nil {
+		return err
+	}
+	entry := models.AuditEntry{
+		Action:     models.AuditGalleryTransfer,
+		TargetType: models.AuditTargetGallery,
+		TargetID:   g.ID,
+	}
+	entry.SetChanges(map[string]models.Change{
+		"user_id": {From: from, To: owner.ID},
+	})
+	cliAudit(services, entry)
+	fmt.Printf("gallery %d now belongs to user %d <%s>\n", g.ID, owner.ID, owner.Email)
+	return nil
+}
@@ -4,28 +4,33 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
-	"hash"
 )
 
 // NewHMAC creates and returns a new HMAC object
 func NewHMAC(key string) HMAC {
-	h := hmac.New(sha256.New, []byte(key))
 	return HMAC{
-		hmac: h,
+		key: []byte(key),
 	}
 }
 
 // HMAC is a wrapper around the crypto/hmac package
 // making it easier to use in the web app
 type HMAC struct {
-	hmac hash.Hash
+	key []byte
 }
 
 // Hash hashes the provided input string using HMAC with
 // the secret key provided when HMAC object was created.
+// A new hash.Hash is used for every call so an HMAC can be
+// shared between goroutines.
 func (h HMAC) Hash(input string) string {
-	h.hmac.Reset()
-	h.hmac.Write([]byte(input))
-	b := h.hmac.Sum(nil)
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(input))
+	b := mac.Sum(nil)
 	return base64.URLEncoding.EncodeToString(b)
 }
+
+// Equal reports whether mac is the HMAC of input, in constant time
+func (h HMAC) Equal(input, mac string) bool {
+	return hmac.Equal([]byte(h.Hash(input)), []byte(mac))
+}
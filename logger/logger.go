@@ -0,0 +1,139 @@
+// Package logger writes structured log entries as one JSON object
+// per line, e.g.
+//
+//	{"time":"2020-10-20T12:00:00Z","level":"info","msg":"request","status":200}
+//
+// A Logger carries a set of fields (such as a request ID) that are
+// added to every entry it writes. Use With to derive a logger with
+// more fields; the original is left untouched.
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Log levels
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelError = "error"
+)
+
+var std = New(os.Stderr)
+
+// Default returns the logger used when no other logger is available,
+// which writes to standard error.
+func Default() *Logger {
+	return std
+}
+
+// New returns a Logger that writes entries to w
+func New(w io.Writer) *Logger {
+	return &Logger{
+		out: w,
+		mu:  &sync.Mutex{},
+	}
+}
+
+// Logger writes structured log entries. It is safe for concurrent use.
+type Logger struct {
+	out    io.Writer
+	mu     *sync.Mutex // shared by every logger derived with With
+	fields []field
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// With returns a new Logger that adds the given key/value pairs to
+// every entry. keyvals alternate between string keys and values.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+len(keyvals)/2)
+	copy(fields, l.fields)
+
+	return &Logger{
+		out:    l.out,
+		mu:     l.mu,
+		fields: append(fields, toFields(keyvals)...),
+	}
+}
+
+// Debug writes a debug level entry
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info writes an info level entry
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Error writes an error level entry
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+func (l *Logger) log(level, msg string, keyvals []interface{}) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeField(&buf, "time", time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteByte(',')
+	writeField(&buf, "level", level)
+	buf.WriteByte(',')
+	writeField(&buf, "msg", msg)
+	for _, f := range l.fields {
+		buf.WriteByte(',')
+		writeField(&buf, f.key, f.value)
+	}
+	for _, f := range toFields(keyvals) {
+		buf.WriteByte(',')
+		writeField(&buf, f.key, f.value)
+	}
+	buf.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(buf.Bytes())
+}
+
+// toFields pairs up keyvals. A key without a value is logged with a
+// nil value rather than being dropped.
+func toFields(keyvals []interface{}) []field {
+	fields := make([]field, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		f := field{key: fmt.Sprint(keyvals[i])}
+		if i+1 < len(keyvals) {
+			f.value = keyvals[i+1]
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func writeField(buf *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+
+	switch v := value.(type) {
+	case error:
+		// errors marshal to {} so log their message instead
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(b)
+}
@@ -1,68 +1,510 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/nahuakang/gophotos/assets"
+	"github.com/nahuakang/gophotos/cache"
+	"github.com/nahuakang/gophotos/config"
 	"github.com/nahuakang/gophotos/controllers"
+	"github.com/nahuakang/gophotos/cookie"
+	"github.com/nahuakang/gophotos/logger"
+	"github.com/nahuakang/gophotos/metrics"
 	"github.com/nahuakang/gophotos/middleware"
 	"github.com/nahuakang/gophotos/models"
-)
-
-const (
-	host     = "localhost"
-	port     = 5432
-	user     = "postgres"
-	password = "qwerty"
-	dbname   = "gophotos_dev"
+	"github.com/nahuakang/gophotos/ratelimit"
+	"github.com/nahuakang/gophotos/tlscert"
+	"github.com/nahuakang/gophotos/trace"
+	"github.com/nahuakang/gophotos/views"
 )
 
 func main() {
-	// Create a DB connection string to create model services
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname,
-	)
+	// The first argument picks a command; "serve" is the default
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	if cmd == "serve" {
+		lg := logger.New(os.Stdout)
+		cfg, err := config.Load(args)
+		if err != nil {
+			lg.Error("loading config", "error", err)
+			os.Exit(2)
+		}
+		if err := serve(cfg, lg); err != nil {
+			lg.Error("server stopped", "reason", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Other commands print their results on stdout, so logs go to stderr
+	lg := logger.New(os.Stderr)
+	var err error
+	switch cmd {
+	case "migrate":
+		err = migrate(args, lg)
+	case "db":
+		err = db(args, lg)
+	case "user":
+		err = user(args, lg)
+	case "gallery":
+		err = gallery(args, lg)
+	case "backup":
+		err = backupArchive(args, lg)
+	case "restore":
+		err = restoreArchive(args, lg)
+	case "help":
+		fmt.Println(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", cmd, usage)
+		os.Exit(2)
+	}
+	switch {
+	case err == errUsage:
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
-	services, err := models.NewServices(psqlInfo)
+// newServices connects to the database and sets up every service
+func newServices(cfg config.Config, lg *logger.Logger) (*models.Services, error) {
+	db := cfg.Database
+	opts := []models.ServicesConfig{
+		models.WithLogger(lg),
+		models.WithGorm(db.Dialect(), db.ConnectionInfo()),
+	}
+	if db.ReplicaDSN != "" {
+		opts = append(opts, models.WithReplica(db.ReplicaDSN))
+	}
+	opts = append(opts, models.WithPool(models.Pool{
+		MaxOpenConns:    db.MaxOpenConns,
+		MaxIdleConns:    db.MaxIdleConns,
+		ConnMaxLifetime: db.ConnMaxLifetime.Duration,
+		ConnMaxIdleTime: db.ConnMaxIdleTime.Duration,
+	}))
+	switch db.SQLLogging(cfg.Env) {
+	case config.LogSQLAll:
+		opts = append(opts, models.WithLogMode(true))
+	case config.LogSQLSlow:
+		opts = append(opts, models.WithSlowQueryLog(db.SlowQuery.Duration))
+	}
+	switch cfg.UserCache.Store {
+	case config.CacheMemory:
+		opts = append(opts, models.WithUserCache(cache.NewLRU(cfg.UserCache.Size), cfg.UserCache.TTL.Duration))
+	case config.CacheMemcached:
+		mc := cache.NewMemcached(cfg.UserCache.MemcachedAddr, "gophotos:", 100*time.Millisecond)
+		opts = append(opts, models.WithUserCache(mc, cfg.UserCache.TTL.Duration))
+	}
+	return models.NewServices(append(opts,
+		models.WithUser(cfg.Pepper, cfg.HMACKey),
+		models.WithGallery(),
+		models.WithAudit(),
+		models.WithRateLimit(),
+	)...)
+}
+
+// serve runs the web app until it receives SIGINT or SIGTERM, then
+// drains in-flight requests and closes the services. It returns nil
+// after a clean shutdown.
+func serve(cfg config.Config, lg *logger.Logger) error {
+	services, err := newServices(cfg, lg)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer func() {
+		if err := services.Close(); err != nil {
+			lg.Error("closing services", "error", err)
+		}
+		lg.Info("services closed")
+	}()
+	if err := checkMigrations(cfg, services, lg); err != nil {
+		return err
+	}
+
+	tracer, closeTracer, err := newTracer(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeTracer()
+
+	if cfg.DevDir != "" {
+		if err := useDevDir(cfg.DevDir); err != nil {
+			return err
+		}
+		lg.Info("reloading templates and assets from disk", "dir", cfg.DevDir)
+	}
+
+	metrics.Register(
+		metrics.NewRuntimeCollector(),
+		metrics.NewDBStatsCollector(services.DBStats),
+	)
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           newHandler(cfg, services, tracer, lg),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Duration,
+		ReadTimeout:       cfg.Server.ReadTimeout.Duration,
+		WriteTimeout:      cfg.Server.WriteTimeout.Duration,
+		IdleTimeout:       cfg.Server.IdleTimeout.Duration,
+	}
+
+	// TLS certificates are reloaded on SIGHUP and when the files change
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var reloader *tlscert.Reloader
+	if cfg.TLS.Enabled() {
+		reloader, err = tlscert.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return fmt.Errorf("loading TLS certificate: %v", err)
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+		go reloader.Watch(ctx, cfg.TLS.ReloadInterval.Duration, func(err error) {
+			lg.Error("reloading TLS certificate", "error", err)
+		})
+	}
+
+	servers := []*http.Server{srv}
+	var redirectSrv, metricsSrv *http.Server
+	if cfg.TLS.RedirectAddr != "" {
+		redirectSrv = &http.Server{
+			Addr:              cfg.TLS.RedirectAddr,
+			Handler:           redirectToHTTPS(cfg.Addr),
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Duration,
+			ReadTimeout:       cfg.Server.ReadTimeout.Duration,
+			WriteTimeout:      cfg.Server.WriteTimeout.Duration,
+			IdleTimeout:       cfg.Server.IdleTimeout.Duration,
+		}
+		servers = append(servers, redirectSrv)
+	}
+	if cfg.Metrics.Addr != "" {
+		metricsSrv = &http.Server{
+			Addr:              cfg.Metrics.Addr,
+			Handler:           metricsHandler(cfg),
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.Duration,
+			ReadTimeout:       cfg.Server.ReadTimeout.Duration,
+			WriteTimeout:      cfg.Server.WriteTimeout.Duration,
+			IdleTimeout:       cfg.Server.IdleTimeout.Duration,
+		}
+		servers = append(servers, metricsSrv)
+	}
+
+	// Every server sends how it stopped, and only the first error is
+	// read, so there must be room for all of them or the rest block
+	// forever after shutdown
+	serveErr := make(chan error, len(servers))
+	go func() {
+		lg.Info("starting the server", "addr", cfg.Addr, "env", cfg.Env, "tls", cfg.TLS.Enabled())
+		if cfg.TLS.Enabled() {
+			// The certificate comes from TLSConfig.GetCertificate
+			serveErr <- srv.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+	if redirectSrv != nil {
+		go func() {
+			lg.Info("redirecting HTTP to HTTPS", "addr", cfg.TLS.RedirectAddr)
+			serveErr <- redirectSrv.ListenAndServe()
+		}()
+	}
+	if metricsSrv != nil {
+		go func() {
+			lg.Info("serving metrics", "addr", cfg.Metrics.Addr)
+			serveErr <- metricsSrv.ListenAndServe()
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(stop)
+
+	for waiting := true; waiting; {
+		select {
+		case err := <-serveErr:
+			// A server failed to start or died; stop the others too
+			for _, s := range servers {
+				s.Close()
+			}
+			return err
+		case sig := <-stop:
+			if sig == syscall.SIGHUP {
+				if reloader == nil {
+					continue
+				}
+				if err := reloader.Reload(); err != nil {
+					lg.Error("reloading TLS certificate", "error", err)
+					continue
+				}
+				lg.Info("reloaded TLS certificate")
+				continue
+			}
+			lg.Info("shutting down", "signal", sig.String(),
+				"drain", cfg.Server.ShutdownTimeout.String())
+			waiting = false
+		}
 	}
-	defer services.Close()
-	services.AutoMigrate()
 
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
+	defer cancelShutdown()
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			// Drain period ran out; cut off the remaining connections
+			for _, s := range servers {
+				s.Close()
+			}
+			return fmt.Errorf("draining requests: %v", err)
+		}
+	}
+	lg.Info("server stopped", "reason", "shutdown signal")
+	return nil
+}
+
+// redirectToHTTPS returns a handler that sends every request to the
+// same URL over HTTPS, on the port of httpsAddr
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		u := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+	})
+}
+
+// newTracer sets up the span exporter picked in the config. The
+// returned function closes the trace file, if any. The tracer is nil
+// when tracing is off.
+func newTracer(cfg config.Config) (*trace.Tracer, func() error, error) {
+	switch cfg.Tracing.Exporter {
+	case config.TraceStderr:
+		// The request log is written to stdout
+		exporter := trace.NewOTLPJSONExporter(os.Stderr, "gophotos")
+		return trace.New(exporter, cfg.Tracing.SampleRatio), func() error { return nil }, nil
+	case config.TraceFile:
+		f, err := os.OpenFile(cfg.Tracing.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening trace file: %v", err)
+		}
+		exporter := trace.NewOTLPJSONExporter(f, "gophotos")
+		return trace.New(exporter, cfg.Tracing.SampleRatio), f.Close, nil
+	default:
+		return nil, func() error { return nil }, nil
+	}
+}
+
+// useDevDir serves templates and assets from the source checkout dir
+// instead of the copies compiled into the binary
+func useDevDir(dir string) error {
+	viewsDir := filepath.Join(dir, "views")
+	assetsDir := filepath.Join(dir, "assets")
+	for _, d := range []string{viewsDir, assetsDir} {
+		if fi, err := os.Stat(d); err != nil || !fi.IsDir() {
+			return fmt.Errorf("dev_dir: %s is not a gophotos checkout, %s is missing", dir, d)
+		}
+	}
+	views.UseDir(viewsDir)
+	assets.UseDir(assetsDir)
+	return nil
+}
+
+// newHandler sets up the routes and middleware of the web app.
+// tracer may be nil to turn tracing off.
+func newHandler(cfg config.Config, services *models.Services, tracer *trace.Tracer, lg *logger.Logger) http.Handler {
 	// Mux Router
 	r := mux.NewRouter()
 	// Controllers
 	staticController := controllers.NewStatic()
-	usersController := controllers.NewUsers(services.User)
-	galleriesController := controllers.NewGalleries(services.Gallery, r)
+	cookiePolicy := cookie.NewPolicy(cfg.CookieKey, cfg.SecureCookies(),
+		cfg.Cookie.Lifetime.Duration,
+		cfg.Cookie.SessionLifetime.Duration,
+		cfg.Cookie.RefreshAfter.Duration,
+	)
+	views.UseFlashKey(cfg.CookieKey, cfg.SecureCookies())
+	usersController := controllers.NewUsers(services.User, services.Audit, cookiePolicy)
+	galleriesController := controllers.NewGalleries(services.Gallery, services.Audit, r)
+	auditController := controllers.NewAudit(services.Audit)
+	healthController := controllers.NewHealth(readinessChecks(services)...)
 
 	// Middleware
-	requireUserMw := middleware.RequireUser{
-		UserService: services.User,
+	userMw := middleware.User{
+		UserService:  services.User,
+		CookiePolicy: cookiePolicy,
+	}
+	requireUserMw := middleware.RequireUser{}
+	requestLoggerMw := middleware.RequestLogger{
+		Logger: lg,
+	}
+	recoveryMw := middleware.Recovery{}
+	metricsMw := middleware.Metrics{}
+	tracingMw := middleware.Tracing{
+		Tracer: tracer,
+	}
+	secureHeadersMw := middleware.SecureHeaders{
+		HSTSMaxAge: 365 * 24 * time.Hour,
+	}
+	if !cfg.TLS.Enabled() && !cfg.IsProd() {
+		// Don't pin local development hosts to HTTPS
+		secureHeadersMw.HSTSMaxAge = 0
+	}
+	// Production is served over HTTPS, by the app itself or by a proxy
+	// in front of it, so only development without TLS is plain HTTP
+	csrfMw := middleware.CSRF{
+		AuthKey:   []byte(cfg.CSRFKey),
+		Secure:    cfg.SecureCookies(),
+		Plaintext: !cfg.SecureCookies(),
+	}
+
+	// Rate limits
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimitStore == "database" {
+		limitStore = services.RateLimit
+	}
+	signupLimit := middleware.RateLimit{
+		Name:  "signup",
+		Store: limitStore,
+		Limit: ratelimit.PerMinute(5, 5),
+		Key:   middleware.KeyByIP,
+	}
+	loginLimit := middleware.RateLimit{
+		Name:    "login",
+		Store:   limitStore,
+		Limit:   ratelimit.PerMinute(10, 10),
+		Key:     middleware.KeyByIP,
+		OnLimit: usersController.LoginLockedOut,
+	}
+	contactLimit := middleware.RateLimit{
+		Name:  "contact",
+		Store: limitStore,
+		Limit: ratelimit.PerMinute(30, 30),
+		Key:   middleware.KeyByIP,
+	}
+	galleryLimit := middleware.RateLimit{
+		Name:  "create_gallery",
+		Store: limitStore,
+		Limit: ratelimit.PerMinute(10, 20),
+		Key:   middleware.KeyByUser,
 	}
 
 	// galleriesController.New is http.Handler, use Apply
 	newGallery := requireUserMw.Apply(galleriesController.New)
 	// galleriesController.Create is http.HandlerFunc, use ApplFn
-	createGallery := requireUserMw.ApplyFn(galleriesController.Create)
+	createGallery := requireUserMw.ApplyFn(galleryLimit.ApplyFn(galleriesController.Create))
 
+	r.PathPrefix(assets.PathPrefix).Handler(assets.Handler()).Methods("GET")
 	r.Handle("/", staticController.Home).Methods("GET")
-	r.Handle("/contact", staticController.Contact).Methods("GET")
+	r.Handle("/contact", contactLimit.Apply(staticController.Contact)).Methods("GET")
 	r.HandleFunc("/signup", usersController.New).Methods("GET")
-	r.HandleFunc("/signup", usersController.Create).Methods("POST")
+	r.HandleFunc("/signup", signupLimit.ApplyFn(usersController.Create)).Methods("POST")
 	r.Handle("/login", usersController.LoginView).Methods("GET")
-	r.HandleFunc("/login", usersController.Login).Methods("POST")
+	r.HandleFunc("/login", loginLimit.ApplyFn(usersController.Login)).Methods("POST")
+	r.HandleFunc("/logout", requireUserMw.ApplyFn(usersController.Logout)).Methods("POST")
 	r.HandleFunc("/cookietest", usersController.CookieTest).Methods("GET")
+	r.HandleFunc("/galleries", requireUserMw.ApplyFn(galleriesController.Index)).
+		Methods("GET").
+		Name(controllers.IndexGalleries)
 	r.Handle("/galleries/new", newGallery).Methods("GET")
 	r.HandleFunc("/galleries", createGallery).Methods("POST")
 	r.HandleFunc("/galleries/{id:[0-9]+}", galleriesController.Show).
 		Methods("GET").
 		Name(controllers.ShowGallery)
-	r.HandleFunc("/galleries/{id:[0-9]+}/edit", requireUserMw.ApplyFn(galleriesController.Edit)).Methods("GET")
+	r.HandleFunc("/galleries/{id:[0-9]+}/edit", requireUserMw.ApplyFn(galleriesController.Edit)).
+		Methods("GET").
+		Name(controllers.EditGallery)
+	r.HandleFunc("/galleries/{id:[0-9]+}/update", requireUserMw.ApplyFn(galleriesController.Update)).Methods("POST")
+	r.HandleFunc("/galleries/{id:[0-9]+}/delete", requireUserMw.ApplyFn(galleriesController.Delete)).Methods("POST")
+
+	r.HandleFunc("/account/activity", requireUserMw.ApplyFn(auditController.Activity)).Methods("GET")
+	r.HandleFunc("/admin/audit", requireUserMw.ApplyFn(auditController.Index)).Methods("GET")
+
+	r.NotFoundHandler = http.HandlerFunc(views.NotFound)
+	r.Use(requestLoggerMw.Route, tracingMw.Route)
 
-	fmt.Println("Starting the server on :3000...")
-	http.ListenAndServe(":3000", r)
+	app := tracingMw.Apply(requestLoggerMw.Apply(metricsMw.Apply(recoveryMw.Apply(
+		secureHeadersMw.Apply(csrfMw.Apply(userMw.Apply(r))),
+	))))
+
+	// Probes and scrapes are polled every few seconds, so they bypass
+	// the session, CSRF and request logging middleware
+	root := http.NewServeMux()
+	root.HandleFunc("/healthz", recoveryMw.ApplyFn(healthController.Healthz))
+	root.HandleFunc("/readyz", recoveryMw.ApplyFn(healthController.Readyz))
+	root.HandleFunc("/version", recoveryMw.ApplyFn(healthController.Version))
+	switch {
+	case cfg.Metrics.Addr != "":
+		// Served by a listener of their own
+	case cfg.IsProd() && !cfg.Metrics.Protected():
+		lg.Info("metrics disabled: set metrics.addr or metrics.username and password")
+	default:
+		root.Handle("/metrics", metricsHandler(cfg))
+	}
+	root.Handle("/", app)
+	return root
+}
+
+// metricsHandler serves the Prometheus metrics, behind basic
+// authentication if it is configured
+func metricsHandler(cfg config.Config) http.Handler {
+	if !cfg.Metrics.Protected() {
+		return metrics.Handler()
+	}
+	basicAuthMw := middleware.BasicAuth{
+		Username: cfg.Metrics.Username,
+		Password: cfg.Metrics.Password,
+		Realm:    "gophotos metrics",
+	}
+	return basicAuthMw.Apply(metrics.Handler())
+}
+
+// readinessChecks returns the checks behind /readyz. Photos are not
+// stored by the app yet, so there is no storage check.
+func readinessChecks(services *models.Services) []controllers.Check {
+	return []controllers.Check{
+		{Name: "database", Fn: services.Ping},
+		{Name: "migrations", Fn: func(ctx context.Context) error {
+			// Pending only reads schema_migrations, so probes
+			// neither wait for nor block a running migration
+			m, err := services.Migrator()
+			if err != nil {
+				return err
+			}
+			pending, err := m.Pending(ctx)
+			if err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("%d pending migrations", len(pending))
+			}
+			return nil
+		}},
+	}
 }
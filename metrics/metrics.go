@@ -0,0 +1,183 @@
+// Package metrics collects counters, gauges and histograms and exposes
+// them in the Prometheus text format.
+//
+// Metrics are usually package level variables registered with the
+// default registry in an init function:
+//
+//	var signups = metrics.NewCounter("gophotos_signups_total", "Accounts created.")
+//
+//	func init() {
+//		metrics.Register(signups)
+//	}
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is the media type of the Prometheus text format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector writes one or more metric families in the text format
+type Collector interface {
+	Collect(w io.Writer)
+}
+
+// Registry is a set of collectors that are written out together
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry used by Register and Handler
+var Default = NewRegistry()
+
+// Register adds collectors to the default registry
+func Register(cs ...Collector) {
+	Default.Register(cs...)
+}
+
+// Handler serves the metrics of the default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Register adds collectors to the registry
+func (r *Registry) Register(cs ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, cs...)
+}
+
+// WriteTo writes every registered metric to w
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var buf bytes.Buffer
+	for _, c := range r.collectors {
+		c.Collect(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// Handler returns an http.Handler that serves the registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-store")
+		r.WriteTo(w)
+	})
+}
+
+// desc describes a metric family
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d *desc) header(w io.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, help, d.name, d.typ)
+}
+
+// sample writes one line of the family. extra is appended to the
+// label pairs, e.g. the le label of histogram buckets.
+func (d *desc) sample(w io.Writer, suffix string, values []string, extra string, v float64) {
+	var labels []string
+	for i, name := range d.labels {
+		labels = append(labels, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if extra != "" {
+		labels = append(labels, extra)
+	}
+	if len(labels) == 0 {
+		fmt.Fprintf(w, "%s%s %s\n", d.name, suffix, formatFloat(v))
+		return
+	}
+	fmt.Fprintf(w, "%s%s{%s} %s\n", d.name, suffix, strings.Join(labels, ","), formatFloat(v))
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// children holds the labelled instances of a vector metric, keyed by
+// their label values
+type children struct {
+	mu     sync.RWMutex
+	values map[string][]string
+	items  map[string]interface{}
+}
+
+// get returns the child for values, creating it with newChild if needed
+func (c *children) get(d *desc, values []string, newChild func() interface{}) interface{} {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	c.mu.RLock()
+	item, ok := c.items[key]
+	c.mu.RUnlock()
+	if ok {
+		return item
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok := c.items[key]; ok {
+		return item
+	}
+	if c.items == nil {
+		c.items = map[string]interface{}{}
+		c.values = map[string][]string{}
+	}
+	item = newChild()
+	c.items[key] = item
+	c.values[key] = append([]string(nil), values...)
+	return item
+}
+
+// each calls fn for every child, ordered by label values so the
+// output is stable
+func (c *children) each(fn func(values []string, item interface{})) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]string, 0, len(c.items))
+	for k := range c.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fn(c.values[k], c.items[k])
+	}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestExpositionFormat(t *testing.T) {
+	reg := NewRegistry()
+
+	logins := NewCounterVec("test_logins_total", "Logins by result.", "result")
+	logins.With("success").Add(3)
+	logins.With("failure").Inc()
+
+	paths := NewCounterVec("test_requests_total", "Requests by path.\nEscaped \\ help.", "path")
+	paths.With(`/say/"hi"`).Inc()
+	paths.With(`C:\photos` + "\n").Inc()
+
+	users := NewGauge("test_users", "Users signed in.")
+	users.Set(2.5)
+
+	latency := NewHistogramVec("test_latency_seconds", "Latency by route.", []float64{1, 0.1, 0.5}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		latency.With("home").Observe(v)
+	}
+	latency.With("contact").Observe(0.2)
+
+	sizes := NewHistogram("test_size_bytes", "Sizes.", []float64{100})
+	reg.Register(logins, paths, users, latency, sizes,
+		NewGaugeFunc("test_inf", "Infinite.", func() float64 { return math.Inf(1) }))
+
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() err = %v, want nil", err)
+	}
+
+	golden := filepath.Join("testdata", "exposition.golden")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("exposition differs from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+func TestCounterCannotDecrease(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Add(-1) did not panic")
+		}
+	}()
+	NewCounter("test_total", "Test.").Add(-1)
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("With() with too few label values did not panic")
+		}
+	}()
+	NewCounterVec("test_total", "Test.", "a", "b").With("a")
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	c := NewCounter("test_total", "Test.")
+	c.Inc()
+	reg.Register(c)
+
+	w := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if got := w.Header().Get("Content-Type"); got != contentType {
+		t.Errorf("Content-Type = %q, want %q", got, contentType)
+	}
+	want := "# HELP test_total Test.\n# TYPE test_total counter\ntest_total 1\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"database/sql"
+	"io"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// NewRuntimeCollector returns a collector for Go runtime and process
+// metrics: goroutines, memory, garbage collection and start time
+func NewRuntimeCollector() Collector {
+	return &runtimeCollector{start: time.Now()}
+}
+
+type runtimeCollector struct {
+	start time.Time
+}
+
+// Collect implements Collector
+func (rc *runtimeCollector) Collect(w io.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	info := desc{name: "go_info", help: "Information about the Go environment.", typ: "gauge", labels: []string{"version"}}
+	info.header(w)
+	info.sample(w, "", []string{runtime.Version()}, "", 1)
+
+	gauges := []struct {
+		name, help string
+		v          float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine())},
+		{"go_threads", "Number of OS threads created.", float64(threads)},
+		{"go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(ms.Alloc)},
+		{"go_memstats_sys_bytes", "Number of bytes obtained from the system.", float64(ms.Sys)},
+		{"go_memstats_heap_objects", "Number of allocated objects.", float64(ms.HeapObjects)},
+		{"go_memstats_next_gc_bytes", "Heap size at which the next garbage collection takes place.", float64(ms.NextGC)},
+		{"process_start_time_seconds", "Start time of the process since the Unix epoch in seconds.", float64(rc.start.UnixNano()) / 1e9},
+	}
+	for _, g := range gauges {
+		d := desc{name: g.name, help: g.help, typ: "gauge"}
+		d.header(w)
+		d.sample(w, "", nil, "", g.v)
+	}
+
+	counters := []struct {
+		name, help string
+		v          float64
+	}{
+		{"go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", float64(ms.TotalAlloc)},
+		{"go_gc_cycles_total", "Number of completed garbage collection cycles.", float64(ms.NumGC)},
+		{"go_gc_pause_seconds_total", "Total time spent in stop-the-world garbage collection pauses.", float64(ms.PauseTotalNs) / 1e9},
+	}
+	for _, c := range counters {
+		d := desc{name: c.name, help: c.help, typ: "counter"}
+		d.header(w)
+		d.sample(w, "", nil, "", c.v)
+	}
+}
+
+// NewDBStatsCollector returns a collector for the connection pool
+// statistics returned by stats, usually sql.DB.Stats, keyed by the
+// value of the pool label, e.g. "primary"
+func NewDBStatsCollector(stats func() map[string]sql.DBStats) Collector {
+	return &dbStatsCollector{stats: stats}
+}
+
+type dbStatsCollector struct {
+	stats func() map[string]sql.DBStats
+}
+
+// Collect implements Collector
+func (dc *dbStatsCollector) Collect(w io.Writer) {
+	pools := dc.stats()
+	names := make([]string, 0, len(pools))
+	for name := range pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := []struct {
+		name, help, typ string
+		v               func(sql.DBStats) float64
+	}{
+		{"gophotos_db_max_open_connections", "Maximum number of open connections to the database.", "gauge",
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"gophotos_db_open_connections", "Number of established connections, in use or idle.", "gauge",
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"gophotos_db_in_use_connections", "Number of connections currently in use.", "gauge",
+			func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"gophotos_db_idle_connections", "Number of idle connections.", "gauge",
+			func(s sql.DBStats) float64 { return float64(s.Idle) }},
+		{"gophotos_db_wait_count_total", "Number of times a query waited for a connection.", "counter",
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"gophotos_db_wait_seconds_total", "Total time spent waiting for a connection.", "counter",
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+		{"gophotos_db_max_idle_closed_total", "Connections closed because of the idle pool limit.", "counter",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+		{"gophotos_db_max_idle_time_closed_total", "Connections closed because they were idle for too long.", "counter",
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }},
+		{"gophotos_db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.", "counter",
+			func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+	}
+	for _, m := range metrics {
+		d := desc{name: m.name, help: m.help, typ: m.typ, labels: []string{"pool"}}
+		d.header(w)
+		for _, name := range names {
+			d.sample(w, "", []string{name}, "", m.v(pools[name]))
+		}
+	}
+}
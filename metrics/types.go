@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are histogram buckets suited to request latencies in
+// seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// value is a float64 that can be updated atomically
+type value struct {
+	bits uint64
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&v.bits, old, next) {
+			return
+		}
+	}
+}
+
+func (v *value) set(f float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(f))
+}
+
+func (v *value) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	desc  desc
+	value value
+}
+
+// NewCounter returns an unlabelled counter
+func NewCounter(name, help string) *Counter {
+	return &Counter{desc: desc{name: name, help: help, typ: "counter"}}
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.value.add(1)
+}
+
+// Add adds delta, which must not be negative, to the counter
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.value.add(delta)
+}
+
+// Collect implements Collector
+func (c *Counter) Collect(w io.Writer) {
+	c.desc.header(w)
+	c.desc.sample(w, "", nil, "", c.value.get())
+}
+
+// CounterVec is a family of counters told apart by label values
+type CounterVec struct {
+	desc     desc
+	children children
+}
+
+// NewCounterVec returns a counter family with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{desc: desc{name: name, help: help, typ: "counter", labels: labels}}
+}
+
+// With returns the counter for the label values, in the order the
+// label names were given
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.children.get(&cv.desc, values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+// Collect implements Collector
+func (cv *CounterVec) Collect(w io.Writer) {
+	cv.desc.header(w)
+	cv.children.each(func(values []string, item interface{}) {
+		cv.desc.sample(w, "", values, "", item.(*Counter).value.get())
+	})
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	desc  desc
+	value value
+}
+
+// NewGauge returns an unlabelled gauge
+func NewGauge(name, help string) *Gauge {
+	return &Gauge{desc: desc{name: name, help: help, typ: "gauge"}}
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) { g.value.set(v) }
+
+// Inc adds one to the gauge
+func (g *Gauge) Inc() { g.value.add(1) }
+
+// Dec subtracts one from the gauge
+func (g *Gauge) Dec() { g.value.add(-1) }
+
+// Collect implements Collector
+func (g *Gauge) Collect(w io.Writer) {
+	g.desc.header(w)
+	g.desc.sample(w, "", nil, "", g.value.get())
+}
+
+// funcMetric reads its value from a function every time it is
+// collected
+type funcMetric struct {
+	desc desc
+	fn   func() float64
+}
+
+// NewGaugeFunc returns a gauge whose value is fn's result
+func NewGaugeFunc(name, help string, fn func() float64) Collector {
+	return &funcMetric{desc: desc{name: name, help: help, typ: "gauge"}, fn: fn}
+}
+
+// NewCounterFunc returns a counter whose value is fn's result. fn
+// must never return less than it did before.
+func NewCounterFunc(name, help string, fn func() float64) Collector {
+	return &funcMetric{desc: desc{name: name, help: help, typ: "counter"}, fn: fn}
+}
+
+// Collect implements Collector
+func (f *funcMetric) Collect(w io.Writer) {
+	f.desc.header(w)
+	f.desc.sample(w, "", nil, "", f.fn())
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	desc    desc
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram returns an unlabelled histogram with the given upper
+// bucket bounds
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return newHistogram(desc{name: name, help: help, typ: "histogram"}, buckets)
+}
+
+func newHistogram(d desc, buckets []float64) *Histogram {
+	bs := append([]float64(nil), buckets...)
+	sort.Float64s(bs)
+	return &Histogram{
+		desc:    d,
+		buckets: bs,
+		counts:  make([]uint64, len(bs)),
+	}
+}
+
+// Observe adds v to the histogram
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// Collect implements Collector
+func (h *Histogram) Collect(w io.Writer) {
+	h.desc.header(w)
+	h.write(w, &h.desc, nil)
+}
+
+// write writes the bucket, sum and count lines with the label values
+// of d
+func (h *Histogram) write(w io.Writer, d *desc, values []string) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += counts[i]
+		d.sample(w, "_bucket", values, `le="`+formatFloat(upper)+`"`, float64(cumulative))
+	}
+	d.sample(w, "_bucket", values, `le="+Inf"`, float64(count))
+	d.sample(w, "_sum", values, "", sum)
+	d.sample(w, "_count", values, "", float64(count))
+}
+
+// HistogramVec is a family of histograms told apart by label values
+type HistogramVec struct {
+	desc     desc
+	buckets  []float64
+	children children
+}
+
+// NewHistogramVec returns a histogram family with the given bucket
+// bounds and label names
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		desc:    desc{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+	}
+}
+
+// With returns the histogram for the label values, in the order the
+// label names were given
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.children.get(&hv.desc, values, func() interface{} {
+		return newHistogram(hv.desc, hv.buckets)
+	}).(*Histogram)
+}
+
+// Collect implements Collector
+func (hv *HistogramVec) Collect(w io.Writer) {
+	hv.desc.header(w)
+	hv.children.each(func(values []string, item interface{}) {
+		item.(*Histogram).write(w, &hv.desc, values)
+	})
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+)
+
+// BasicAuth is the middleware that requires HTTP basic authentication
+// with a single username and password, for endpoints meant for
+// machines such as /metrics.
+type BasicAuth struct {
+	Username string
+	Password string
+	// Realm is shown by browsers in the login prompt
+	Realm string
+}
+
+// Apply applies middleware to http.Handler interfaces
+func (mw *BasicAuth) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn returns an http.HandlerFunc that calls next(w, r) only if
+// the request carries the right credentials, and answers 401
+// otherwise
+func (mw *BasicAuth) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || !equal(user, mw.Username) || !equal(pass, mw.Password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+mw.Realm+`", charset="UTF-8"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// equal compares a and b in constant time. Hashing first hides the
+// length of the expected value too.
+func equal(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	mw := BasicAuth{
+		Username: "prometheus",
+		Password: "s3cret",
+		Realm:    "gophotos metrics",
+	}
+	h := mw.ApplyFn(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metrics"))
+	})
+
+	tests := []struct {
+		name     string
+		user     string
+		pass     string
+		noHeader bool
+		want     int
+	}{
+		{name: "valid", user: "prometheus", pass: "s3cret", want: http.StatusOK},
+		{name: "no credentials", noHeader: true, want: http.StatusUnauthorized},
+		{name: "wrong password", user: "prometheus", pass: "guess", want: http.StatusUnauthorized},
+		{name: "wrong user", user: "admin", pass: "s3cret", want: http.StatusUnauthorized},
+		{name: "password prefix", user: "prometheus", pass: "s3c", want: http.StatusUnauthorized},
+		{name: "empty", user: "", pass: "", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			if !tt.noHeader {
+				r.SetBasicAuth(tt.user, tt.pass)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tt.want == http.StatusOK {
+				if body := w.Body.String(); body != "metrics" {
+					t.Errorf("body = %q, want the wrapped handler's", body)
+				}
+				if challenge != "" {
+					t.Errorf("WWW-Authenticate = %q on success, want none", challenge)
+				}
+				return
+			}
+			want := `Basic realm="gophotos metrics", charset="UTF-8"`
+			if challenge != want {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, want)
+			}
+		})
+	}
+}
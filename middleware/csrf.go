@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/csrf"
+	"github.com/nahuakang/gophotos/views"
+)
+
+// CSRF is the middleware that protects every state-changing request
+// (POST, PUT, PATCH, DELETE) with a token tied to the visitor's CSRF
+// cookie. Forms include the token through the csrfField template func.
+type CSRF struct {
+	// AuthKey is the 32 byte key used to authenticate the CSRF cookie.
+	AuthKey []byte
+	// Secure marks the CSRF cookie as HTTPS only.
+	Secure bool
+	// Plaintext tells csrf that the app is reached over plain HTTP,
+	// which turns off its strict Referer check for HTTPS. It must
+	// only be set when there is no TLS at all: behind a proxy that
+	// terminates TLS, requests arrive without r.TLS but the browser
+	// still uses HTTPS.
+	Plaintext bool
+}
+
+// Apply applies middleware to http.Handler interfaces
+func (mw *CSRF) Apply(next http.Handler) http.HandlerFunc {
+	protect := csrf.Protect(
+		mw.AuthKey,
+		csrf.Secure(mw.Secure),
+		csrf.Path("/"),
+		csrf.SameSite(csrf.SameSiteLaxMode),
+		csrf.ErrorHandler(http.HandlerFunc(views.Forbidden)),
+	)(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// csrf assumes HTTPS and enforces strict Referer checks unless
+		// told otherwise, which would reject every form over plain HTTP.
+		if mw.Plaintext {
+			r = csrf.PlaintextHTTPRequest(r)
+		}
+		protect.ServeHTTP(w, r)
+	})
+}
+
+// ApplyFn applies middleware to http.HandlerFunc
+func (mw *CSRF) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return mw.Apply(next)
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/csrf"
+)
+
+var testCSRFKey = []byte("gophotos-csrf-secret-32-byte-key")
+
+// newCSRFHandler returns mw around a handler that writes the CSRF token
+func newCSRFHandler(mw CSRF) http.HandlerFunc {
+	return mw.ApplyFn(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, csrf.Token(r))
+	})
+}
+
+// csrfToken gets a CSRF cookie and the token to go with it from h
+func csrfToken(t *testing.T, h http.Handler) (*http.Cookie, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "https://gophotos.example/galleries/new", nil))
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || len(cookies) != 1 {
+		t.Fatalf("GET = %d with %d cookies, want 200 with the CSRF cookie", w.Code, len(cookies))
+	}
+	return cookies[0], w.Body.String()
+}
+
+func TestCSRF(t *testing.T) {
+	h := newCSRFHandler(CSRF{AuthKey: testCSRFKey, Secure: true})
+	cookie, token := csrfToken(t, h)
+	_, otherToken := csrfToken(t, h)
+
+	tests := []struct {
+		name    string
+		cookie  bool
+		token   string
+		referer string
+		want    int
+	}{
+		{"valid", true, token, "https://gophotos.example/galleries/new", http.StatusOK},
+		{"no token", true, "", "https://gophotos.example/galleries/new", http.StatusForbidden},
+		{"bad token", true, "bm90IGEgdG9rZW4=", "https://gophotos.example/galleries/new", http.StatusForbidden},
+		{"token for another cookie", true, otherToken, "https://gophotos.example/galleries/new", http.StatusForbidden},
+		{"no cookie", false, token, "https://gophotos.example/galleries/new", http.StatusForbidden},
+		// Requests arrive without r.TLS, as they do behind a proxy
+		// terminating TLS, and must still get the Referer checks
+		{"no referer", true, token, "", http.StatusForbidden},
+		{"cross-site referer", true, token, "https://evil.example/", http.StatusForbidden},
+		{"plain HTTP referer", true, token, "http://gophotos.example/galleries/new", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "https://gophotos.example/galleries", nil)
+			r.TLS = nil
+			if tt.cookie {
+				r.AddCookie(cookie)
+			}
+			if tt.token != "" {
+				r.Header.Set("X-CSRF-Token", tt.token)
+			}
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.want {
+				t.Errorf("POST status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFPlaintext(t *testing.T) {
+	h := newCSRFHandler(CSRF{AuthKey: testCSRFKey, Plaintext: true})
+	cookie, token := csrfToken(t, h)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		// Browsers often leave out the Referer over plain HTTP
+		{"valid without a referer", token, http.StatusOK},
+		{"no token", "", http.StatusForbidden},
+		{"bad token", "bm90IGEgdG9rZW4=", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "http://localhost:3000/galleries", nil)
+			r.AddCookie(cookie)
+			if tt.token != "" {
+				r.Header.Set("X-CSRF-Token", tt.token)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.want {
+				t.Errorf("POST status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
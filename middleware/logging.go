@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bufio"
+	stdcontext "context"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nahuakang/gophotos/context"
+	"github.com/nahuakang/gophotos/logger"
+	"github.com/nahuakang/gophotos/rand"
+	"github.com/nahuakang/gophotos/trace"
+)
+
+// requestIDHeader is the header used to accept and return request IDs
+const requestIDHeader = "X-Request-ID"
+
+// requestIDBytes is the number of random bytes in a generated request ID
+const requestIDBytes = 12
+
+// validRequestID limits which incoming request IDs are trusted, so a
+// client cannot inject arbitrary text into the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,64}$`)
+
+type logKey string
+
+const accessKey logKey = "access"
+
+// access collects the details of a request that are only known to
+// handlers further down the chain, such as the matched route and
+// the signed in user.
+type access struct {
+	route  string
+	userID uint
+}
+
+// RequestLogger is the middleware that assigns every request an ID,
+// stores a logger carrying that ID in the request context and writes
+// one structured entry per request once it has been served.
+//
+// RequestLogger must wrap the router, and Route must be registered on
+// the router with Use so the route name can be recorded.
+type RequestLogger struct {
+	Logger *logger.Logger
+}
+
+// Apply applies middleware to http.Handler interfaces
+func (mw *RequestLogger) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn applies middleware to http.HandlerFunc
+func (mw *RequestLogger) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			var err error
+			id, err = rand.String(requestIDBytes)
+			if err != nil {
+				mw.Logger.Error("generating request ID", "error", err)
+			}
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		lg := mw.Logger.With("request_id", id)
+		if span := trace.FromContext(r.Context()); span != nil {
+			lg = lg.With("trace_id", span.Context().TraceID.String())
+		}
+		info := &access{}
+		ctx := context.WithLogger(r.Context(), lg)
+		ctx = contextWithAccess(ctx, info)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		keyvals := []interface{}{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", info.route,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if info.userID != 0 {
+			keyvals = append(keyvals, "user_id", info.userID)
+		}
+		lg.Info("request", keyvals...)
+	})
+}
+
+// Route records the name of the matched mux route for the request
+// log. Register it with router.Use.
+func (mw *RequestLogger) Route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := accessFrom(r); info != nil {
+			if route := mux.CurrentRoute(r); route != nil {
+				info.route = route.GetName()
+				if info.route == "" {
+					info.route, _ = route.GetPathTemplate()
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func contextWithAccess(ctx stdcontext.Context, info *access) stdcontext.Context {
+	return stdcontext.WithValue(ctx, accessKey, info)
+}
+
+func accessFrom(r *http.Request) *access {
+	info, _ := r.Context().Value(accessKey).(*access)
+	return info
+}
+
+// statusRecorder is an http.ResponseWriter that remembers the status
+// code and number of bytes written.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer does
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("middleware: response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
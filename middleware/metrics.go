@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nahuakang/gophotos/metrics"
+)
+
+var (
+	httpRequestDuration = metrics.NewHistogramVec(
+		"gophotos_http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by mux route.",
+		metrics.DefBuckets,
+		"method", "route", "status",
+	)
+	httpRequestsInFlight = metrics.NewGauge(
+		"gophotos_http_requests_in_flight",
+		"HTTP requests currently being served.",
+	)
+)
+
+func init() {
+	metrics.Register(httpRequestDuration, httpRequestsInFlight)
+}
+
+// Metrics is the middleware that records the latency of every request
+// in a histogram labelled with the method, mux route and status.
+//
+// Metrics must run inside RequestLogger, which finds out the route
+// name; requests that matched no route are labelled "none".
+type Metrics struct{}
+
+// Apply applies middleware to http.Handler interfaces
+func (mw *Metrics) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn applies middleware to http.HandlerFunc
+func (mw *Metrics) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := "none"
+		if info := accessFrom(r); info != nil && info.route != "" {
+			route = info.route
+		}
+		httpRequestDuration.
+			With(methodLabel(r.Method), route, strconv.Itoa(rec.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel keeps arbitrary methods sent by clients from creating
+// new label values
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
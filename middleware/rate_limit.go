@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nahuakang/gophotos/context"
+	"github.com/nahuakang/gophotos/metrics"
+	"github.com/nahuakang/gophotos/ratelimit"
+	"github.com/nahuakang/gophotos/views"
+)
+
+var rateLimitedTotal = metrics.NewCounterVec(
+	"gophotos_rate_limited_requests_total",
+	"Requests turned away with a 429 by a rate limit.",
+	"limit",
+)
+
+func init() {
+	metrics.Register(rateLimitedTotal)
+}
+
+// RateLimitKey returns the bucket key a request is counted against
+type RateLimitKey func(r *http.Request) string
+
+// KeyByIP counts requests per client IP address (from RemoteAddr, so
+// a reverse proxy must preserve the client address).
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// KeyByUser counts requests per signed in user, falling back to the
+// client IP for anonymous visitors.
+func KeyByUser(r *http.Request) string {
+	if user := context.User(r.Context()); user != nil {
+		return "user:" + strconv.FormatUint(uint64(user.ID), 10)
+	}
+	return KeyByIP(r)
+}
+
+// KeyByRoute counts every request to the matched mux route together,
+// regardless of who made it.
+func KeyByRoute(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if name := route.GetName(); name != "" {
+			return "route:" + name
+		}
+		tpl, _ := route.GetPathTemplate()
+		return "route:" + tpl
+	}
+	return "route:" + r.URL.Path
+}
+
+// RateLimit is the middleware that limits how often a route can be
+// called. Wrap each route (or group of routes) with its own RateLimit
+// to give it a separate limit:
+//
+//	loginLimit := middleware.RateLimit{
+//		Name:  "login",
+//		Store: store,
+//		Limit: ratelimit.PerMinute(10, 5),
+//		Key:   middleware.KeyByIP,
+//	}
+//	r.HandleFunc("/login", loginLimit.ApplyFn(usersC.Login))
+//
+// Requests over the limit get a 429 with a Retry-After header.
+type RateLimit struct {
+	// Name separates the buckets of this limit from other limits
+	// using the same Store and Key.
+	Name  string
+	Store ratelimit.Store
+	Limit ratelimit.Limit
+	// Key picks the bucket for a request. Defaults to KeyByIP.
+	Key RateLimitKey
+	// OnLimit, if set, is called for every request that is turned
+	// away.
+	OnLimit func(r *http.Request)
+}
+
+// Apply applies middleware to http.Handler interfaces
+func (mw *RateLimit) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn applies middleware to http.HandlerFunc
+func (mw *RateLimit) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyFn := mw.Key
+		if keyFn == nil {
+			keyFn = KeyByIP
+		}
+		key := mw.Name + ":" + keyFn(r)
+
+		ok, retryAfter, err := mw.Store.Take(key, mw.Limit, time.Now())
+		if err != nil {
+			// Fail open: a broken store shouldn't take the site down
+			context.Logger(r.Context()).Error("rate limit store", "key", key, "error", err)
+			next(w, r)
+			return
+		}
+		if !ok {
+			rateLimitedTotal.With(mw.Name).Inc()
+			if mw.OnLimit != nil {
+				mw.OnLimit(r)
+			}
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			views.Error(w, r, http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	})
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nahuakang/gophotos/ratelimit"
+)
+
+// fakeStore answers every Take the same way and records the keys
+type fakeStore struct {
+	ok         bool
+	retryAfter time.Duration
+	err        error
+	keys       []string
+}
+
+func (fs *fakeStore) Take(key string, limit ratelimit.Limit, now time.Time) (bool, time.Duration, error) {
+	fs.keys = append(fs.keys, key)
+	return fs.ok, fs.retryAfter, fs.err
+}
+
+func serveRateLimited(store ratelimit.Store, onLimit func(*http.Request)) (*httptest.ResponseRecorder, bool) {
+	called := false
+	mw := RateLimit{
+		Name:    "login",
+		Store:   store,
+		Limit:   ratelimit.PerMinute(10, 5),
+		OnLimit: onLimit,
+	}
+	h := mw.ApplyFn(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w, called
+}
+
+func TestRateLimitAllows(t *testing.T) {
+	store := &fakeStore{ok: true}
+	w, called := serveRateLimited(store, nil)
+	if !called {
+		t.Errorf("handler was not called for an allowed request")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if len(store.keys) != 1 || store.keys[0] != "login:ip:192.0.2.1" {
+		t.Errorf("keys = %q, want [login:ip:192.0.2.1]", store.keys)
+	}
+}
+
+func TestRateLimitRejects(t *testing.T) {
+	store := &fakeStore{ok: false, retryAfter: 1500 * time.Millisecond}
+	limited := false
+	w, called := serveRateLimited(store, func(*http.Request) { limited = true })
+	if called {
+		t.Errorf("handler was called for a rate limited request")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	// Retry-After is rounded up to whole seconds
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+	if !limited {
+		t.Errorf("OnLimit was not called")
+	}
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	store := &fakeStore{err: errors.New("database is down")}
+	w, called := serveRateLimited(store, nil)
+	if !called {
+		t.Errorf("handler was not called when the store failed")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimitMemoryStore(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	mw := RateLimit{
+		Name:  "signup",
+		Store: store,
+		Limit: ratelimit.PerMinute(1, 2),
+	}
+	h := mw.ApplyFn(func(w http.ResponseWriter, r *http.Request) {})
+
+	codes := make([]int, 3)
+	for i := range codes {
+		r := httptest.NewRequest("POST", "/signup", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		h(w, r)
+		codes[i] = w.Code
+	}
+	want := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("statuses = %v, want %v", codes, want)
+			break
+		}
+	}
+}
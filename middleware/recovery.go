@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/nahuakang/gophotos/context"
+	"github.com/nahuakang/gophotos/views"
+)
+
+// Recovery is the middleware that recovers from panics in later
+// handlers, logs them with a stack trace and responds with the 500
+// error page instead of dropping the connection.
+type Recovery struct{}
+
+// Apply applies middleware to http.Handler interfaces
+func (mw *Recovery) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn applies middleware to http.HandlerFunc
+func (mw *Recovery) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// Let net/http abort the response as intended
+				panic(err)
+			}
+
+			context.Logger(r.Context()).Error("panic",
+				"error", err,
+				"stack", string(debug.Stack()),
+			)
+			// Only send the error page if nothing was written yet,
+			// otherwise it would be appended to a partial response.
+			if rec.status == 0 {
+				views.InternalServerError(rec, r)
+			}
+		}()
+
+		next(rec, r)
+	})
+}
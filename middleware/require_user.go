@@ -1,52 +1,82 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/nahuakang/gophotos/context"
+	"github.com/nahuakang/gophotos/cookie"
 	"github.com/nahuakang/gophotos/models"
+	"github.com/nahuakang/gophotos/trace"
 )
 
-// RequireUser is the middleware that checks if a user is logged in
-type RequireUser struct {
+// User is the middleware that looks up the current user, if any,
+// and stores it in the request context. It never redirects, so it
+// can wrap every route including public pages.
+type User struct {
 	models.UserService
+	CookiePolicy *cookie.Policy
 }
 
 // Apply applies middleware to http.Handler interfaces
-func (mw *RequireUser) Apply(next http.Handler) http.HandlerFunc {
+func (mw *User) Apply(next http.Handler) http.HandlerFunc {
 	return mw.ApplyFn(next.ServeHTTP)
 }
 
-// ApplyFn returns an http.HandlerFunc that checks if a user is
-// logged in and then either calls  next(w, r) if they are, or
-// redirect the user to the login page if they are not.
-func (mw *RequireUser) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
-	// Return a dynamically created func(http.ResponseWriter, *http.Request)
-	// but also convert it into an http.HandlerFunc
+// ApplyFn returns an http.HandlerFunc that resolves the user from the
+// remember_token cookie and then calls next(w, r) either way. Cookies
+// in use are refreshed according to the cookie policy.
+func (mw *User) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if user is logged in.
-		cookie, err := r.Cookie("remember_token")
+		rem, err := mw.CookiePolicy.Read(r)
 		if err != nil {
-			// If user is not logged in, http.Redirect to "/login"
-			http.Redirect(w, r, "/login", http.StatusFound)
+			// No valid cookie means an anonymous visitor
+			next(w, r)
 			return
 		}
 
-		user, err := mw.UserService.ByRemember(cookie.Value)
-		if err != nil {
-			// If user does not exist in DB, http.Redirect to "/login"
-			http.Redirect(w, r, "/login", http.StatusFound)
+		lookupCtx, span := trace.Start(r.Context(), "middleware.User")
+		user, err := mw.UserService.WithContext(lookupCtx).ByRemember(rem.Token)
+		span.End()
+		if err != nil || user.Disabled {
+			// A stale or unknown token, or a disabled account, is
+			// treated as anonymous too
+			next(w, r)
 			return
 		}
-		fmt.Println("User found: ", user)
+		mw.CookiePolicy.Refresh(w, rem)
+
+		if info := accessFrom(r); info != nil {
+			info.userID = user.ID
+		}
 
-		// Get the context from request
-		ctx := r.Context()
 		// Create a new context from the existing one that includes the user
-		ctx = context.WithUser(ctx, user)
+		ctx := context.WithUser(r.Context(), user)
+		ctx = context.WithLogger(ctx, context.Logger(ctx).With("user_id", user.ID))
 		// Create a new request from the existing one with the context attached
-		r = r.WithContext(ctx)
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// RequireUser is the middleware that checks if a user is logged in.
+// It assumes the User middleware has already been run.
+type RequireUser struct{}
+
+// Apply applies middleware to http.Handler interfaces
+func (mw *RequireUser) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn returns an http.HandlerFunc that checks if a user is
+// logged in and then either calls next(w, r) if they are, or
+// redirect the user to the login page if they are not.
+func (mw *RequireUser) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := context.User(r.Context())
+		if user == nil {
+			// If user is not logged in, http.Redirect to "/login"
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
 		// If user exists, call next(w, r)
 		next(w, r)
 	})
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/nahuakang/gophotos/trace"
+)
+
+// Tracing is the middleware that starts a server span for every
+// request, continuing the trace of an incoming traceparent header, and
+// stores it in the request context for child spans.
+//
+// Tracing should wrap RequestLogger so request log entries carry the
+// trace ID, and Route must be registered on the router with Use to
+// name spans after the matched route. A nil Tracer disables tracing.
+type Tracing struct {
+	Tracer *trace.Tracer
+}
+
+// Apply applies middleware to http.Handler interfaces
+func (mw *Tracing) Apply(next http.Handler) http.HandlerFunc {
+	return mw.ApplyFn(next.ServeHTTP)
+}
+
+// ApplyFn applies middleware to http.HandlerFunc
+func (mw *Tracing) ApplyFn(next http.HandlerFunc) http.HandlerFunc {
+	if mw.Tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, _ := trace.Extract(r.Header)
+		ctx, span := mw.Tracer.StartServer(r.Context(), "HTTP "+r.Method, remote)
+		defer span.End()
+		span.SetAttributes(
+			"http.method", r.Method,
+			"http.target", r.URL.Path,
+			"http.user_agent", r.UserAgent(),
+		)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes("http.status_code", rec.status)
+		if rec.status >= http.StatusInternalServerError {
+			span.RecordError(httpError(rec.status))
+		}
+	})
+}
+
+// Route names the request span after the matched mux route. Register
+// it with router.Use.
+func (mw *Tracing) Route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.FromContext(r.Context())
+		if route := mux.CurrentRoute(r); route != nil && span != nil {
+			tpl, _ := route.GetPathTemplate()
+			span.SetName(r.Method + " " + tpl)
+			span.SetAttributes("http.route", tpl)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpError is the error recorded on spans of failed requests
+type httpError int
+
+func (e httpError) Error() string {
+	return http.StatusText(int(e))
+}
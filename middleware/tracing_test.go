@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/nahuakang/gophotos/trace"
+)
+
+// spanRecorder is a trace.Exporter that keeps every span
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []trace.SpanData
+}
+
+func (sr *spanRecorder) Export(span trace.SpanData) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.spans = append(sr.spans, span)
+}
+
+const (
+	incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incomingSpanID  = "00f067aa0ba902b7"
+)
+
+func newTracedRouter(rec *spanRecorder, handler http.HandlerFunc) http.Handler {
+	tracingMw := Tracing{Tracer: trace.New(rec, 0)}
+	r := mux.NewRouter()
+	r.HandleFunc("/galleries/{id:[0-9]+}", handler)
+	r.Use(tracingMw.Route)
+	return tracingMw.Apply(r)
+}
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+	rec := &spanRecorder{}
+	var inHandler trace.SpanContext
+	h := newTracedRouter(rec, func(w http.ResponseWriter, r *http.Request) {
+		inHandler = trace.FromContext(r.Context()).Context()
+	})
+
+	r := httptest.NewRequest("GET", "/galleries/7", nil)
+	r.Header.Set("traceparent", "00-"+incomingTraceID+"-"+incomingSpanID+"-01")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got := inHandler.TraceID.String(); got != incomingTraceID {
+		t.Errorf("handler trace ID = %s, want the incoming %s", got, incomingTraceID)
+	}
+	// The sample ratio is 0, so only the caller's decision exports it
+	if len(rec.spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(rec.spans))
+	}
+	span := rec.spans[0]
+	if span.TraceID.String() != incomingTraceID {
+		t.Errorf("span trace ID = %s, want %s", span.TraceID, incomingTraceID)
+	}
+	if span.Parent.String() != incomingSpanID {
+		t.Errorf("span parent = %s, want the incoming span %s", span.Parent, incomingSpanID)
+	}
+	if span.SpanID.String() == incomingSpanID {
+		t.Errorf("span ID = %s, want a new one", span.SpanID)
+	}
+	if span.SpanID != inHandler.SpanID {
+		t.Errorf("handler saw span %s, want the request span %s", inHandler.SpanID, span.SpanID)
+	}
+	if span.Name != "GET /galleries/{id:[0-9]+}" {
+		t.Errorf("span name = %q, want it named after the route", span.Name)
+	}
+	if span.Kind != trace.KindServer {
+		t.Errorf("span kind = %d, want %d", span.Kind, trace.KindServer)
+	}
+}
+
+func TestTracingNotSampled(t *testing.T) {
+	rec := &spanRecorder{}
+	h := newTracedRouter(rec, func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, header := range []string{
+		"",
+		"00-" + incomingTraceID + "-" + incomingSpanID + "-00",
+		"garbage",
+	} {
+		r := httptest.NewRequest("GET", "/galleries/7", nil)
+		if header != "" {
+			r.Header.Set("traceparent", header)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if len(rec.spans) != 0 {
+		t.Errorf("exported %d spans of unsampled traces, want none", len(rec.spans))
+	}
+}
+
+func TestTracingRecordsServerErrors(t *testing.T) {
+	rec := &spanRecorder{}
+	h := newTracedRouter(rec, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	r := httptest.NewRequest("GET", "/galleries/7", nil)
+	r.Header.Set("traceparent", "00-"+incomingTraceID+"-"+incomingSpanID+"-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(rec.spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(rec.spans))
+	}
+	if got := rec.spans[0].Error; got != "Internal Server Error" {
+		t.Errorf("span error = %q, want %q", got, "Internal Server Error")
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	called := false
+	mw := Tracing{}
+	h := mw.ApplyFn(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if span := trace.FromContext(r.Context()); span != nil {
+			t.Errorf("request has a span with tracing disabled")
+		}
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !called {
+		t.Errorf("handler was not called")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/nahuakang/gophotos/config"
+	"github.com/nahuakang/gophotos/logger"
+	"github.com/nahuakang/gophotos/models"
+)
+
+const migrateUsage = `usage: gophotos migrate <up|down [steps]|status> [flags]
+
+  up       apply every pending migration
+  down     roll back the latest migration, or the latest [steps]
+  status   list migrations and whether they have been applied`
+
+// migrate runs the migrate command
+func migrate(args []string, lg *logger.Logger) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	action, args := args[0], args[1:]
+
+	steps := 1
+	if action == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 {
+				return errors.New("migrate down: steps must be at least 1")
+			}
+			steps, args = n, args[1:]
+		}
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	m, err := services.Migrator()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("already up to date")
+		}
+	case "down":
+		rolledBack, err := m.Down(ctx, steps)
+		for _, mig := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("nothing to roll back")
+		}
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			status, at := "pending", ""
+			if s.Applied {
+				status, at = "applied", s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			if s.Modified {
+				status = "MODIFIED"
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, status, at)
+		}
+		tw.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
+
+// checkMigrations makes sure the schema is current before serving.
+// In development pending migrations are applied automatically; in
+// production they must be applied with "gophotos migrate up" first.
+func checkMigrations(cfg config.Config, services *models.Services, lg *logger.Logger) error {
+	m, err := services.Migrator()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if cfg.IsProd() {
+		return fmt.Errorf("%d pending migrations; run \"gophotos migrate up\" first", len(pending))
+	}
+
+	applied, err := m.Up(ctx)
+	for _, mig := range applied {
+		lg.Info("applied migration", "version", mig.Version, "name", mig.Name)
+	}
+	return err
+}
@@ -0,0 +1,394 @@
+// Package migrations manages the database schema with versioned SQL
+// files compiled into the binary. Files live in sql/<dialect>/ and are
+// named <version>_<name>.up.sql and <version>_<name>.down.sql, e.g.
+//
+//	sql/postgres/0002_create_galleries.up.sql
+//	sql/postgres/0002_create_galleries.down.sql
+//
+// Applied versions are recorded in the schema_migrations table along
+// with a checksum of their files, so a migration that was edited after
+// being applied is reported instead of silently ignored.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql
+var files embed.FS
+
+// lockID is the key of the Postgres advisory lock held while
+// migrating, so that two instances starting at once cannot both
+// apply the same migration. It is an arbitrary constant.
+const lockID = 7_261_004_553
+
+var (
+	// ErrChecksumMismatch is returned when an applied migration's
+	// files have changed since it was applied.
+	ErrChecksumMismatch = errors.New("migrations: applied migration has been modified")
+
+	// ErrUnknownVersion is returned when the database has a version
+	// applied that this binary has no files for, e.g. after a
+	// rollback to an older release.
+	ErrUnknownVersion = errors.New("migrations: database has an unknown migration applied")
+)
+
+// Migration is a single schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status describes a migration and whether it has been applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is true if the migration's files changed after it was
+	// applied.
+	Modified bool
+}
+
+// New returns a Migrator for db. dialect is the gorm dialect name,
+// e.g. "postgres", and selects the directory of SQL files.
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	return newMigrator(db, dialect, files)
+}
+
+// newMigrator returns a Migrator for the migrations of dialect in
+// fsys, which is laid out like the embedded files
+func newMigrator(db *sql.DB, dialect string, fsys fs.FS) (*Migrator, error) {
+	migrations, err := load(fsys, dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// Migrator applies and rolls back migrations
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration // sorted by version
+}
+
+// Status returns every known migration in order, with whether it has
+// been applied. It only reads the database: it neither takes the
+// migration lock nor creates schema_migrations, so it is cheap enough
+// for health checks.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	exists, err := m.tableExists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		// Nothing has been migrated yet
+		statuses := make([]Status, len(m.migrations))
+		for i, mig := range m.migrations {
+			statuses[i].Migration = mig
+		}
+		return statuses, nil
+	}
+	return m.status(ctx, m.db)
+}
+
+// Pending returns the migrations that have not been applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in order, each in its own
+// transaction, and returns the migrations applied. It refuses to run
+// if an applied migration has been modified.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withConn(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkModified(statuses); err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			if s.Applied {
+				continue
+			}
+			err := m.exec(ctx, conn, s.Up,
+				"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ("+
+					m.placeholders(4)+")",
+				s.Version, s.Name, s.Checksum, time.Now().UTC(),
+			)
+			if err != nil {
+				return fmt.Errorf("migrations: applying %04d_%s: %v", s.Version, s.Name, err)
+			}
+			applied = append(applied, s.Migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the latest steps applied migrations, newest first,
+// and returns the migrations rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var rolledBack []Migration
+	err := m.withConn(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkModified(statuses); err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			s := statuses[i]
+			if !s.Applied {
+				continue
+			}
+			err := m.exec(ctx, conn, s.Down,
+				"DELETE FROM schema_migrations WHERE version = "+m.placeholders(1),
+				s.Version,
+			)
+			if err != nil {
+				return fmt.Errorf("migrations: rolling back %04d_%s: %v", s.Version, s.Name, err)
+			}
+			rolledBack = append(rolledBack, s.Migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// withConn runs fn on a single connection holding the migration lock.
+// The schema_migrations table is created first if needed.
+func (m *Migrator) withConn(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect == "postgres" {
+		// Advisory locks belong to the session, which is why every
+		// statement has to run on this one connection.
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+			return fmt.Errorf("migrations: acquiring lock: %v", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+	}
+
+	// SQLite drivers only parse columns declared as datetime into time.Time
+	timestamp := "timestamp with time zone"
+	if m.dialect != "postgres" {
+		timestamp = "datetime"
+	}
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		checksum text NOT NULL,
+		applied_at `+timestamp+` NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("migrations: creating schema_migrations: %v", err)
+	}
+
+	return fn(conn)
+}
+
+// exec runs a migration's SQL and the statement recording it in one
+// transaction
+func (m *Migrator) exec(ctx context.Context, conn *sql.Conn, migration, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// tableExists reports whether schema_migrations has been created
+func (m *Migrator) tableExists(ctx context.Context) (bool, error) {
+	query := "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	if m.dialect == "postgres" {
+		query = "SELECT count(*) FROM pg_catalog.pg_tables WHERE schemaname = current_schema() AND tablename = 'schema_migrations'"
+	}
+	var n int
+	if err := m.db.QueryRowContext(ctx, query).Scan(&n); err != nil {
+		return false, fmt.Errorf("migrations: checking for schema_migrations: %v", err)
+	}
+	return n > 0, nil
+}
+
+// queryer is implemented by *sql.DB and *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (m *Migrator) status(ctx context.Context, q queryer) ([]Status, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT version, checksum, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type applied struct {
+		checksum string
+		at       time.Time
+	}
+	done := map[int]applied{}
+	for rows.Next() {
+		var version int
+		var a applied
+		if err := rows.Scan(&version, &a.checksum, &a.at); err != nil {
+			return nil, err
+		}
+		done[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i].Migration = mig
+		if a, ok := done[mig.Version]; ok {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt = a.at
+			statuses[i].Modified = a.checksum != mig.Checksum
+			delete(done, mig.Version)
+		}
+	}
+	for version := range done {
+		return nil, fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+	}
+	return statuses, nil
+}
+
+// placeholders returns n comma separated bind parameters
+func (m *Migrator) placeholders(n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		if m.dialect == "postgres" {
+			ps[i] = "$" + strconv.Itoa(i+1)
+		} else {
+			ps[i] = "?"
+		}
+	}
+	return strings.Join(ps, ", ")
+}
+
+func checkModified(statuses []Status) error {
+	for _, s := range statuses {
+		if s.Modified {
+			return fmt.Errorf("%w: %04d_%s", ErrChecksumMismatch, s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// load reads the migrations for dialect from fsys
+func load(fsys fs.FS, dialect string) ([]Migration, error) {
+	dir := path.Join("sql", dialect)
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: no migrations for dialect %q", dialect)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migrations: unexpected file %s", name)
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		sep := strings.IndexByte(base, '_')
+		if sep < 0 {
+			return nil, fmt.Errorf("migrations: file %s must be named <version>_<name>", name)
+		}
+		version, err := strconv.Atoi(base[:sep])
+		if err != nil {
+			return nil, fmt.Errorf("migrations: file %s has an invalid version", name)
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: base[sep+1:]}
+			byVersion[version] = mig
+		}
+		if mig.Name != base[sep+1:] {
+			return nil, fmt.Errorf("migrations: version %d is used by two migrations", version)
+		}
+		if direction == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migrations: %04d_%s needs both an up and a down file",
+				mig.Version, mig.Name)
+		}
+		sum := sha256.Sum256([]byte(mig.Up + "\x00" + mig.Down))
+		mig.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
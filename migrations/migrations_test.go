@@ -0,0 +1,286 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testFiles returns migrations creating tables a and b
+func testFiles() fstest.MapFS {
+	return fstest.MapFS{
+		"sql/sqlite3/0001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id integer PRIMARY KEY)")},
+		"sql/sqlite3/0001_create_a.down.sql": {Data: []byte("DROP TABLE a")},
+		"sql/sqlite3/0002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id integer PRIMARY KEY)")},
+		"sql/sqlite3/0002_create_b.down.sql": {Data: []byte("DROP TABLE b")},
+	}
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// Every connection to ":memory:" gets a database of its own
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+	m, err := newMigrator(db, "sqlite3", fsys)
+	if err != nil {
+		t.Fatalf("newMigrator() err = %v, want nil", err)
+	}
+	return m
+}
+
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	t.Helper()
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+	if err != nil {
+		t.Fatalf("looking up table %s: %v", table, err)
+	}
+	return n > 0
+}
+
+func versions(migrations []Migration) []int {
+	vs := make([]int, len(migrations))
+	for i, m := range migrations {
+		vs[i] = m.Version
+	}
+	return vs
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	m := newTestMigrator(t, db, testFiles())
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() err = %v, want nil", err)
+	}
+	if len(statuses) != 2 || statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("Status() on a new database = %+v, want 2 migrations, none applied", statuses)
+	}
+	if tableExists(t, db, "schema_migrations") {
+		t.Errorf("Status() created schema_migrations, want it read-only")
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() err = %v, want nil", err)
+	}
+	if got := versions(applied); !equalInts(got, []int{1, 2}) {
+		t.Errorf("Up() applied %v, want [1 2]", got)
+	}
+	if !tableExists(t, db, "a") || !tableExists(t, db, "b") {
+		t.Errorf("tables a and b missing after Up()")
+	}
+
+	statuses, err = m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() err = %v, want nil", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.AppliedAt.IsZero() || s.Modified {
+			t.Errorf("Status() after Up() = %+v, want applied, with a time, unmodified", s)
+		}
+	}
+
+	applied, err = m.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second Up() = %v, %v, want nothing applied", versions(applied), err)
+	}
+
+	rolledBack, err := m.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("Down(1) err = %v, want nil", err)
+	}
+	if got := versions(rolledBack); !equalInts(got, []int{2}) {
+		t.Errorf("Down(1) rolled back %v, want [2]", got)
+	}
+	if tableExists(t, db, "b") {
+		t.Errorf("table b exists after rolling it back")
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatalf("Pending() err = %v, want nil", err)
+	}
+	if got := versions(pending); !equalInts(got, []int{2}) {
+		t.Errorf("Pending() = %v, want [2]", got)
+	}
+
+	rolledBack, err = m.Down(ctx, 5)
+	if err != nil {
+		t.Fatalf("Down(5) err = %v, want nil", err)
+	}
+	if got := versions(rolledBack); !equalInts(got, []int{1}) {
+		t.Errorf("Down(5) rolled back %v, want [1]", got)
+	}
+	if tableExists(t, db, "a") {
+		t.Errorf("table a exists after rolling everything back")
+	}
+}
+
+func TestModifiedMigration(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if _, err := newTestMigrator(t, db, testFiles()).Up(ctx); err != nil {
+		t.Fatalf("Up() err = %v, want nil", err)
+	}
+
+	fsys := testFiles()
+	fsys["sql/sqlite3/0001_create_a.up.sql"] = &fstest.MapFile{
+		Data: []byte("CREATE TABLE a (id integer PRIMARY KEY, name text)"),
+	}
+	fsys["sql/sqlite3/0003_create_c.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE c (id integer)")}
+	fsys["sql/sqlite3/0003_create_c.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE c")}
+	m := newTestMigrator(t, db, fsys)
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() err = %v, want nil", err)
+	}
+	if !statuses[0].Modified || statuses[1].Modified {
+		t.Errorf("Status() Modified = %v, %v, want true, false", statuses[0].Modified, statuses[1].Modified)
+	}
+
+	if _, err := m.Up(ctx); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Up() err = %v, want %v", err, ErrChecksumMismatch)
+	}
+	if tableExists(t, db, "c") {
+		t.Errorf("Up() applied 0003 despite the modified 0001")
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Down() err = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
+
+func TestUnknownVersion(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	if _, err := newTestMigrator(t, db, testFiles()).Up(ctx); err != nil {
+		t.Fatalf("Up() err = %v, want nil", err)
+	}
+
+	// An older build that only knows the first migration
+	fsys := testFiles()
+	delete(fsys, "sql/sqlite3/0002_create_b.up.sql")
+	delete(fsys, "sql/sqlite3/0002_create_b.down.sql")
+	m := newTestMigrator(t, db, fsys)
+	if _, err := m.Status(ctx); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Status() err = %v, want %v", err, ErrUnknownVersion)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	fsys := testFiles()
+	fsys["sql/sqlite3/0002_create_b.up.sql"] = &fstest.MapFile{
+		Data: []byte("CREATE TABLE b (id integer PRIMARY KEY); INSERT INTO missing VALUES (1)"),
+	}
+	m := newTestMigrator(t, db, fsys)
+
+	applied, err := m.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "0002_create_b") {
+		t.Fatalf("Up() err = %v, want an error naming 0002_create_b", err)
+	}
+	if got := versions(applied); !equalInts(got, []int{1}) {
+		t.Errorf("Up() applied %v, want [1]", got)
+	}
+	if tableExists(t, db, "b") {
+		t.Errorf("table b exists, want the failed migration rolled back")
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatalf("Pending() err = %v, want nil", err)
+	}
+	if got := versions(pending); !equalInts(got, []int{2}) {
+		t.Errorf("Pending() = %v, want [2]", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string // part of the error, or "" for none
+	}{
+		{"valid", testFiles(), ""},
+		{"unknown dialect", fstest.MapFS{}, "no migrations"},
+		{"missing down file", fstest.MapFS{
+			"sql/sqlite3/0001_create_a.up.sql": {Data: []byte("CREATE TABLE a (id integer)")},
+		}, "needs both"},
+		{"unexpected file", fstest.MapFS{
+			"sql/sqlite3/README.md": {Data: []byte("notes")},
+		}, "unexpected file"},
+		{"no name", fstest.MapFS{
+			"sql/sqlite3/0001.up.sql": {Data: []byte("SELECT 1")},
+		}, "must be named"},
+		{"invalid version", fstest.MapFS{
+			"sql/sqlite3/one_create_a.up.sql": {Data: []byte("SELECT 1")},
+		}, "invalid version"},
+		{"duplicate version", fstest.MapFS{
+			"sql/sqlite3/0001_create_a.up.sql":   {Data: []byte("SELECT 1")},
+			"sql/sqlite3/0001_create_a.down.sql": {Data: []byte("SELECT 1")},
+			"sql/sqlite3/0001_create_b.up.sql":   {Data: []byte("SELECT 1")},
+		}, "used by two migrations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.files, "sqlite3")
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("load() err = %v, want nil", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("load() err = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestEmbedded checks that the shipped migrations load and that every
+// dialect has the same versions
+func TestEmbedded(t *testing.T) {
+	var want []int
+	for _, dialect := range []string{"postgres", "sqlite3"} {
+		migrations, err := load(files, dialect)
+		if err != nil {
+			t.Fatalf("load(%s) err = %v, want nil", dialect, err)
+		}
+		got := versions(migrations)
+		if want == nil {
+			want = got
+		} else if !equalInts(got, want) {
+			t.Errorf("%s versions = %v, want %v", dialect, got, want)
+		}
+	}
+
+	if _, err := New(newTestDB(t), "sqlite3"); err != nil {
+		t.Errorf("New() err = %v, want nil", err)
+	}
+}
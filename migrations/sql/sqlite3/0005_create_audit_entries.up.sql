@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS audit_entries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    actor_id integer,
+    action text NOT NULL,
+    target_type text,
+    target_id integer,
+    ip text,
+    user_agent text,
+    note text,
+    changes text,
+    admin boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_entries_created_at ON audit_entries (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_actor_id ON audit_entries (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_action ON audit_entries (action);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_target_type ON audit_entries (target_type);
+CREATE INDEX IF NOT EXISTS idx_audit_entries_target_id ON audit_entries (target_id);
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrActionRequired is returned if an audit entry has no action
+const ErrActionRequired modelError = "models: audit action is required"
+
+// Audit actions. Actions are named "<target type>.<verb>".
+const (
+	AuditUserCreate      = "user.create"
+	AuditUserLogin       = "user.login"
+	AuditUserLoginFailed = "user.login_failed"
+	AuditUserLogout      = "user.logout"
+	AuditUserPassword    = "user.password_change"
+	AuditUserDisable     = "user.disable"
+	AuditGalleryCreate   = "gallery.create"
+	AuditGalleryUpdate   = "gallery.update"
+	AuditGalleryDelete   = "gallery.delete"
+	AuditGalleryTransfer = "gallery.transfer_owner"
+	AuditSystemBackup    = "system.backup"
+	AuditSystemRestore   = "system.restore"
+)
+
+// Audit target types
+const (
+	AuditTargetUser    = "user"
+	AuditTargetGallery = "gallery"
+	AuditTargetSystem  = "system"
+)
+
+// defaultAuditLimit is the number of entries List returns if the
+// filter does not set a limit.
+const defaultAuditLimit = 100
+
+// AuditEntry records a security or content event: who (ActorID) did
+// what (Action) to which record (TargetType and TargetID), from where
+// (IP and UserAgent). Entries are only ever appended, never changed.
+type AuditEntry struct {
+	ID         uint      `gorm:"primary_key"`
+	CreatedAt  time.Time `gorm:"index"`
+	ActorID    uint      `gorm:"index"` // 0 for anonymous visitors
+	Action     string    `gorm:"not null;index"`
+	TargetType string    `gorm:"index"`
+	TargetID   uint      `gorm:"index"`
+	IP         string
+	UserAgent  string
+	// Note holds extra context, e.g. the email of a failed login.
+	Note string
+	// Changes is a JSON object of field name to Change.
+	Changes string `gorm:"type:text"`
+	// Admin marks actions an administrator took on someone else's
+	// records, or through the command line.
+	Admin bool `gorm:"not null;default:false"`
+}
+
+// Change is the value of a field before and after an update
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// SetChanges stores changes on the entry as JSON
+func (e *AuditEntry) SetChanges(changes map[string]Change) error {
+	if len(changes) == 0 {
+		e.Changes = ""
+		return nil
+	}
+	b, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	e.Changes = string(b)
+	return nil
+}
+
+// ChangeSet returns the changes stored on the entry. Entries without
+// (or with unreadable) changes return nil.
+func (e AuditEntry) ChangeSet() map[string]Change {
+	if e.Changes == "" {
+		return nil
+	}
+	var changes map[string]Change
+	if err := json.Unmarshal([]byte(e.Changes), &changes); err != nil {
+		return nil
+	}
+	return changes
+}
+
+// AuditFilter narrows down the entries returned by AuditDB.List.
+// Zero values match everything.
+type AuditFilter struct {
+	ActorID    uint
+	Action     string
+	TargetType string
+	TargetID   uint
+	// UserID matches entries the user either performed or was the
+	// target of, such as failed logins to their account
+	UserID uint
+	Since  time.Time
+	Until  time.Time
+	// Limit caps the number of entries, newest first. Defaults to 100.
+	Limit int
+}
+
+// NewAuditService returns an AuditService
+func NewAuditService(db *gorm.DB) AuditService {
+	return &auditService{
+		AuditDB: &auditValidator{
+			AuditDB: &auditGorm{
+				db: db,
+			},
+		},
+	}
+}
+
+// AuditService is an interface that represents services to AuditEntry
+type AuditService interface {
+	AuditDB
+}
+
+type auditService struct {
+	AuditDB
+}
+
+// AuditDB interacts with the audit log. It has no methods to change
+// or delete entries on purpose.
+type AuditDB interface {
+	Record(entry *AuditEntry) error
+	List(filter AuditFilter) ([]AuditEntry, error)
+}
+
+type auditValidator struct {
+	AuditDB
+}
+
+// Record validates the entry before appending it to the log
+func (av *auditValidator) Record(entry *AuditEntry) error {
+	if entry.Action == "" {
+		return ErrActionRequired
+	}
+	// Entries are append only, so never let a caller overwrite one
+	entry.ID = 0
+	return av.AuditDB.Record(entry)
+}
+
+// List applies the default limit before listing entries
+func (av *auditValidator) List(filter AuditFilter) ([]AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	return av.AuditDB.List(filter)
+}
+
+// Ensure auditGorm implements AuditDB interface
+var _ AuditDB = &auditGorm{}
+
+type auditGorm struct {
+	db *gorm.DB
+}
+
+func (ag *auditGorm) Record(entry *AuditEntry) error {
+	return ag.db.Create(entry).Error
+}
+
+func (ag *auditGorm) List(filter AuditFilter) ([]AuditEntry, error) {
+	db := ag.db
+	if filter.ActorID != 0 {
+		db = db.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.UserID != 0 {
+		db = db.Where("actor_id = ? OR (target_type = ? AND target_id = ?)",
+			filter.UserID, AuditTargetUser, filter.UserID)
+	}
+	if filter.Action != "" {
+		db = db.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		db = db.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != 0 {
+		db = db.Where("target_id = ?", filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		db = db.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		db = db.Where("created_at < ?", filter.Until)
+	}
+
+	var entries []AuditEntry
+	err := db.Order("created_at desc, id desc").Limit(filter.Limit).Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrNotEmpty is returned by Restore when the database already holds
+// records
+const ErrNotEmpty modelError = "models: the database is not empty"
+
+// Dump is a logical copy of every record, including soft deleted
+// users and galleries. It holds password and remember token hashes, so
+// it is as sensitive as the database itself.
+type Dump struct {
+	Users        []User
+	Galleries    []Gallery
+	AuditEntries []AuditEntry
+}
+
+// Dump reads every record inside a single read-only transaction, so
+// the copy is consistent even while the app is serving requests.
+// Rate limit buckets are not included.
+func (s *Services) Dump() (*Dump, error) {
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer tx.Rollback()
+
+	if tx.Dialect().GetName() == "postgres" {
+		// A snapshot for the whole transaction instead of one per query
+		err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY").Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var d Dump
+	tx = tx.Unscoped()
+	if err := tx.Order("id").Find(&d.Users).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Order("id").Find(&d.Galleries).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Order("id").Find(&d.AuditEntries).Error; err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Restore inserts every record of d, keeping their IDs, into a
+// database that has been migrated but holds no users, galleries or
+// audit entries. Records are inserted in one transaction, so a failed
+// restore leaves the database empty.
+func (s *Services) Restore(d *Dump) error {
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer tx.Rollback()
+
+	for _, model := range []interface{}{&User{}, &Gallery{}, &AuditEntry{}} {
+		var n int
+		if err := tx.Unscoped().Model(model).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrNotEmpty
+		}
+	}
+
+	for i := range d.Users {
+		if err := tx.Create(&d.Users[i]).Error; err != nil {
+			return fmt.Errorf("restoring user %d: %v", d.Users[i].ID, err)
+		}
+	}
+	for i := range d.Galleries {
+		if err := tx.Create(&d.Galleries[i]).Error; err != nil {
+			return fmt.Errorf("restoring gallery %d: %v", d.Galleries[i].ID, err)
+		}
+	}
+	for i := range d.AuditEntries {
+		if err := tx.Create(&d.AuditEntries[i]).Error; err != nil {
+			return fmt.Errorf("restoring audit entry %d: %v", d.AuditEntries[i].ID, err)
+		}
+	}
+
+	if err := resetSequences(tx, "users", "galleries", "audit_entries"); err != nil {
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// resetSequences moves the ID sequences of tables past the highest
+// restored ID. Postgres sequences don't notice explicit IDs; SQLite
+// keeps track of them by itself.
+func resetSequences(tx *gorm.DB, tables ...string) error {
+	if tx.Dialect().GetName() != "postgres" {
+		return nil
+	}
+	for _, table := range tables {
+		err := tx.Exec(fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s",
+			table,
+		)).Error
+		if err != nil {
+			return fmt.Errorf("resetting the %s ID sequence: %v", table, err)
+		}
+	}
+	return nil
+}
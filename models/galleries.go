@@ -1,6 +1,10 @@
 package models
 
-import "github.com/jinzhu/gorm"
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+)
 
 const (
 	// ErrUserIDRequired is returned if user ID is not present
@@ -18,22 +22,70 @@ type Gallery struct {
 
 // NewGalleryService returns a GalleryService
 func NewGalleryService(db *gorm.DB) GalleryService {
+	return newGalleryService(NewGormGalleryDB(db))
+}
+
+// NewGormGalleryDB returns the GalleryDB that stores galleries with
+// gorm, without the validation layer
+func NewGormGalleryDB(db *gorm.DB) GalleryDB {
+	return &galleryGorm{
+		db:      db,
+		replica: db,
+	}
+}
+
+// NewMemoryGalleryService returns a GalleryService that keeps
+// galleries in memory instead of a database
+func NewMemoryGalleryService() GalleryService {
+	return newGalleryService(NewMemoryGalleryDB())
+}
+
+func newGalleryService(gdb GalleryDB) GalleryService {
+	primary := gdb
+	if pr, ok := gdb.(galleryPrimaryReader); ok {
+		primary = pr.primary()
+	}
+
 	return &galleryService{
 		GalleryDB: &galleryValidator{
-			GalleryDB: &galleryGorm{
-				db: db,
-			},
+			GalleryDB: gdb,
 		},
+		primary: primary,
 	}
 }
 
+// galleryPrimaryReader is primaryReader for GalleryDBs
+type galleryPrimaryReader interface {
+	primary() GalleryDB
+}
+
 // GalleryService is an interface that represents services to Gallery
 type GalleryService interface {
+	// WithContext returns a GalleryService that records a trace span
+	// under ctx for every call
+	WithContext(ctx context.Context) GalleryService
+	// ByIDPrimary is ByID on the primary database. Use it to look up
+	// a gallery that is about to be changed, or whose owner decides
+	// whether a change is allowed, since a replica may be behind.
+	ByIDPrimary(id uint) (*Gallery, error)
 	GalleryDB
 }
 
 type galleryService struct {
 	GalleryDB
+	// primary reads from the primary database even if GalleryDB
+	// reads from a replica
+	primary GalleryDB
+}
+
+// ByIDPrimary looks up the gallery on the primary database
+func (gs *galleryService) ByIDPrimary(id uint) (*Gallery, error) {
+	return gs.primary.ByID(id)
+}
+
+// WithContext returns gs with tracing under ctx
+func (gs *galleryService) WithContext(ctx context.Context) GalleryService {
+	return &tracedGalleryService{GalleryService: gs, ctx: ctx}
 }
 
 // GalleryDB interacts with the galleries database.
@@ -44,7 +96,11 @@ type galleryService struct {
 // If another error occurs, that error is returned.
 type GalleryDB interface {
 	ByID(id uint) (*Gallery, error)
+	ByUserID(userID uint) ([]Gallery, error)
+	All() ([]Gallery, error)
 	Create(gallery *Gallery) error
+	Update(gallery *Gallery) error
+	Delete(id uint) error
 }
 
 type galleryValidator struct {
@@ -65,6 +121,33 @@ func (gv *galleryValidator) Create(gallery *Gallery) error {
 	return gv.GalleryDB.Create(gallery)
 }
 
+// Update validates the gallery before updating it
+func (gv *galleryValidator) Update(gallery *Gallery) error {
+	err := runGalleryValFns(
+		gallery,
+		gv.userIDRequired,
+		gv.titleRequired,
+	)
+	if err != nil {
+		return err
+	}
+
+	return gv.GalleryDB.Update(gallery)
+}
+
+// Delete deletes the gallery with the provided ID
+func (gv *galleryValidator) Delete(id uint) error {
+	var gallery Gallery
+	gallery.ID = id
+
+	err := runGalleryValFns(&gallery, gv.nonZeroID)
+	if err != nil {
+		return err
+	}
+
+	return gv.GalleryDB.Delete(id)
+}
+
 func (gv *galleryValidator) userIDRequired(g *Gallery) error {
 	if g.UserID <= 0 {
 		return ErrUserIDRequired
@@ -79,35 +162,77 @@ func (gv *galleryValidator) titleRequired(g *Gallery) error {
 	return nil
 }
 
+func (gv *galleryValidator) nonZeroID(g *Gallery) error {
+	if g.ID <= 0 {
+		return ErrIDInvalid
+	}
+	return nil
+}
+
 // Ensure galleryGorm implements GalleryDB interface
 var _ GalleryDB = &galleryGorm{}
 
+// galleryGorm writes to db and reads from replica, which is db itself
+// unless the services have a read replica
 type galleryGorm struct {
-	db *gorm.DB
+	db      *gorm.DB
+	replica *gorm.DB
 }
 
 func (gg *galleryGorm) ByID(id uint) (*Gallery, error) {
 	var gallery Gallery
-	db := gg.db.Where("id = ?", id)
-	err := first(db, &gallery)
+	err := firstOnReplica(gg.db, gg.replica, &gallery, "id = ?", id)
 	if err != nil {
 		return nil, err
 	}
 	return &gallery, nil
 }
 
+func (gg *galleryGorm) ByUserID(userID uint) ([]Gallery, error) {
+	var galleries []Gallery
+	err := gg.replica.Where("user_id = ?", userID).Find(&galleries).Error
+	if err != nil {
+		return nil, err
+	}
+	return galleries, nil
+}
+
+func (gg *galleryGorm) All() ([]Gallery, error) {
+	var galleries []Gallery
+	err := gg.replica.Order("id").Find(&galleries).Error
+	if err != nil {
+		return nil, err
+	}
+	return galleries, nil
+}
+
 func (gg *galleryGorm) Create(gallery *Gallery) error {
 	return gg.db.Create(gallery).Error
 }
 
+func (gg *galleryGorm) Update(gallery *Gallery) error {
+	return gg.db.Save(gallery).Error
+}
+
+func (gg *galleryGorm) Delete(id uint) error {
+	gallery := Gallery{Model: gorm.Model{ID: id}}
+	return gg.db.Delete(&gallery).Error
+}
+
+// primary implements galleryPrimaryReader
+func (gg *galleryGorm) primary() GalleryDB {
+	return &galleryGorm{db: gg.db, replica: gg.db}
+}
+
 type galleryValFn func(*Gallery) error
 
+// runGalleryValFns runs the validation functions like runUserValFns
 func runGalleryValFns(gallery *Gallery, fns ...galleryValFn) error {
+	var verr ValidationError
 	for _, fn := range fns {
-		if err := fn(gallery); err != nil {
+		if err := fn(gallery); err != nil && !verr.add(err) {
 			return err
 		}
 	}
-
-	return nil
+	return verr.err()
 }
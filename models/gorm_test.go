@@ -0,0 +1,46 @@
+package models_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/nahuakang/gophotos/migrations"
+	"github.com/nahuakang/gophotos/models"
+	"github.com/nahuakang/gophotos/models/modeltest"
+)
+
+// newSQLiteDB returns a fully migrated in-memory SQLite database that
+// is closed when the test ends
+func newSQLiteDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("opening SQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	// Every connection to ":memory:" gets a database of its own
+	db.DB().SetMaxOpenConns(1)
+
+	m, err := migrations.New(db.DB(), "sqlite3")
+	if err != nil {
+		t.Fatalf("migrations.New() err = %v", err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return db
+}
+
+func TestGormUserDB(t *testing.T) {
+	modeltest.TestUserDB(t, func() models.UserDB {
+		return models.NewGormUserDB(newSQLiteDB(t))
+	})
+}
+
+func TestGormGalleryDB(t *testing.T) {
+	modeltest.TestGalleryDB(t, func() models.GalleryDB {
+		return models.NewGormGalleryDB(newSQLiteDB(t))
+	})
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// errRememberTaken is the in-memory counterpart of a violation of the
+// unique index on remember_hash. With random 32 byte tokens it never
+// happens outside of tests.
+const errRememberTaken modelError = "models: remember token is already in use"
+
+// Ensure the in-memory implementations satisfy their interfaces
+var (
+	_ UserDB    = &memoryUserDB{}
+	_ GalleryDB = &memoryGalleryDB{}
+)
+
+// NewMemoryUserDB returns a UserDB that keeps users in memory. It
+// behaves like the gorm implementation, including the unique email and
+// remember hash constraints, which makes it a stand-in for the
+// database in tests. Like userGorm, it expects the validation layer to
+// normalize emails and hash remember tokens.
+func NewMemoryUserDB() UserDB {
+	return &memoryUserDB{
+		users: map[uint]User{},
+	}
+}
+
+type memoryUserDB struct {
+	mu     sync.RWMutex
+	users  map[uint]User
+	lastID uint
+}
+
+func (mu *memoryUserDB) ByID(id uint) (*User, error) {
+	return mu.find(func(u *User) bool { return u.ID == id })
+}
+
+func (mu *memoryUserDB) ByEmail(email string) (*User, error) {
+	return mu.find(func(u *User) bool { return u.Email == email })
+}
+
+func (mu *memoryUserDB) ByRemember(rememberHash string) (*User, error) {
+	return mu.find(func(u *User) bool { return u.RememberHash == rememberHash })
+}
+
+func (mu *memoryUserDB) All() ([]User, error) {
+	mu.mu.RLock()
+	defer mu.mu.RUnlock()
+
+	users := make([]User, 0, len(mu.users))
+	for _, u := range mu.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (mu *memoryUserDB) Create(user *User) error {
+	mu.mu.Lock()
+	defer mu.mu.Unlock()
+
+	if err := mu.checkUnique(user); err != nil {
+		return err
+	}
+	mu.lastID++
+	user.ID = mu.lastID
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	mu.users[user.ID] = stored(*user)
+	return nil
+}
+
+func (mu *memoryUserDB) Update(user *User) error {
+	mu.mu.Lock()
+	defer mu.mu.Unlock()
+
+	if _, ok := mu.users[user.ID]; !ok {
+		return ErrNotFound
+	}
+	if err := mu.checkUnique(user); err != nil {
+		return err
+	}
+	user.UpdatedAt = time.Now()
+	updated := stored(*user)
+	if updated.PasswordHash == "" {
+		updated.PasswordHash = mu.users[user.ID].PasswordHash
+	}
+	mu.users[user.ID] = updated
+	return nil
+}
+
+func (mu *memoryUserDB) Delete(id uint) error {
+	mu.mu.Lock()
+	defer mu.mu.Unlock()
+
+	delete(mu.users, id)
+	return nil
+}
+
+// find returns a copy of the first user matching fn
+func (mu *memoryUserDB) find(fn func(*User) bool) (*User, error) {
+	mu.mu.RLock()
+	defer mu.mu.RUnlock()
+
+	for _, u := range mu.users {
+		if fn(&u) {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// checkUnique enforces the unique indexes on email and remember_hash
+// against every user other than user itself
+func (mu *memoryUserDB) checkUnique(user *User) error {
+	for _, u := range mu.users {
+		if u.ID == user.ID {
+			continue
+		}
+		if u.Email == user.Email {
+			return ErrEmailTaken
+		}
+		if u.RememberHash == user.RememberHash {
+			return errRememberTaken
+		}
+	}
+	return nil
+}
+
+// stored returns the copy of user that is kept in memory. Like the
+// columns tagged gorm:"-", Password and Remember are never stored.
+func stored(user User) User {
+	user.Password = ""
+	user.Remember = ""
+	return user
+}
+
+// NewMemoryGalleryDB returns a GalleryDB that keeps galleries in
+// memory
+func NewMemoryGalleryDB() GalleryDB {
+	return &memoryGalleryDB{
+		galleries: map[uint]Gallery{},
+	}
+}
+
+type memoryGalleryDB struct {
+	mu        sync.RWMutex
+	galleries map[uint]Gallery
+	lastID    uint
+}
+
+func (mg *memoryGalleryDB) ByID(id uint) (*Gallery, error) {
+	mg.mu.RLock()
+	defer mg.mu.RUnlock()
+
+	g, ok := mg.galleries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &g, nil
+}
+
+func (mg *memoryGalleryDB) ByUserID(userID uint) ([]Gallery, error) {
+	return mg.filter(func(g *Gallery) bool { return g.UserID == userID }), nil
+}
+
+func (mg *memoryGalleryDB) All() ([]Gallery, error) {
+	return mg.filter(func(*Gallery) bool { return true }), nil
+}
+
+func (mg *memoryGalleryDB) Create(gallery *Gallery) error {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+
+	mg.lastID++
+	gallery.ID = mg.lastID
+	gallery.CreatedAt = time.Now()
+	gallery.UpdatedAt = gallery.CreatedAt
+	mg.galleries[gallery.ID] = *gallery
+	return nil
+}
+
+func (mg *memoryGalleryDB) Update(gallery *Gallery) error {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+
+	if _, ok := mg.galleries[gallery.ID]; !ok {
+		return ErrNotFound
+	}
+	gallery.UpdatedAt = time.Now()
+	mg.galleries[gallery.ID] = *gallery
+	return nil
+}
+
+func (mg *memoryGalleryDB) Delete(id uint) error {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+
+	delete(mg.galleries, id)
+	return nil
+}
+
+// filter returns copies of the galleries matching fn, ordered by ID
+func (mg *memoryGalleryDB) filter(fn func(*Gallery) bool) []Gallery {
+	mg.mu.RLock()
+	defer mg.mu.RUnlock()
+
+	var galleries []Gallery
+	for _, g := range mg.galleries {
+		if fn(&g) {
+			galleries = append(galleries, g)
+		}
+	}
+	sort.Slice(galleries, func(i, j int) bool { return galleries[i].ID < galleries[j].ID })
+	return galleries
+}
@@ -0,0 +1,16 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nahuakang/gophotos/models"
+	"github.com/nahuakang/gophotos/models/modeltest"
+)
+
+func TestMemoryUserDB(t *testing.T) {
+	modeltest.TestUserDB(t, models.NewMemoryUserDB)
+}
+
+func TestMemoryGalleryDB(t *testing.T) {
+	modeltest.TestGalleryDB(t, models.NewMemoryGalleryDB)
+}
@@ -0,0 +1,351 @@
+// Package modeltest has conformance suites for implementations of the
+// models storage interfaces. Every implementation of models.UserDB or
+// models.GalleryDB, in memory or backed by a database, is expected to
+// pass them:
+//
+//	func TestMemoryUserDB(t *testing.T) {
+//		modeltest.TestUserDB(t, models.NewMemoryUserDB)
+//	}
+//
+// The suites exercise the storage layer directly, so they pass values
+// the way the validation layer would: emails already normalized and
+// remember tokens already hashed.
+package modeltest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nahuakang/gophotos/models"
+)
+
+// TestUserDB runs the UserDB conformance suite. newDB is called once
+// per subtest and must return an empty UserDB.
+func TestUserDB(t *testing.T, newDB func() models.UserDB) {
+	t.Run("lookups of missing users return ErrNotFound", func(t *testing.T) {
+		udb := newDB()
+		if _, err := udb.ByID(42); err != models.ErrNotFound {
+			t.Errorf("ByID() err = %v, want %v", err, models.ErrNotFound)
+		}
+		if _, err := udb.ByEmail("nobody@example.com"); err != models.ErrNotFound {
+			t.Errorf("ByEmail() err = %v, want %v", err, models.ErrNotFound)
+		}
+		if _, err := udb.ByRemember("no-such-hash"); err != models.ErrNotFound {
+			t.Errorf("ByRemember() err = %v, want %v", err, models.ErrNotFound)
+		}
+	})
+
+	t.Run("create assigns an ID and timestamps", func(t *testing.T) {
+		udb := newDB()
+		a := newUser(1)
+		b := newUser(2)
+		mustCreateUser(t, udb, a)
+		mustCreateUser(t, udb, b)
+		if a.ID == 0 || b.ID == 0 || a.ID == b.ID {
+			t.Errorf("IDs = %d and %d, want distinct non-zero IDs", a.ID, b.ID)
+		}
+		if a.CreatedAt.IsZero() || a.UpdatedAt.IsZero() {
+			t.Errorf("CreatedAt = %v, UpdatedAt = %v, want both set", a.CreatedAt, a.UpdatedAt)
+		}
+	})
+
+	t.Run("lookups find the created user", func(t *testing.T) {
+		udb := newDB()
+		want := newUser(1)
+		mustCreateUser(t, udb, want)
+
+		lookups := []struct {
+			name string
+			fn   func() (*models.User, error)
+		}{
+			{"ByID", func() (*models.User, error) { return udb.ByID(want.ID) }},
+			{"ByEmail", func() (*models.User, error) { return udb.ByEmail(want.Email) }},
+			{"ByRemember", func() (*models.User, error) { return udb.ByRemember(want.RememberHash) }},
+		}
+		for _, l := range lookups {
+			got, err := l.fn()
+			if err != nil {
+				t.Errorf("%s() err = %v, want nil", l.name, err)
+				continue
+			}
+			checkUser(t, l.name, got, want)
+		}
+	})
+
+	t.Run("email must be unique", func(t *testing.T) {
+		udb := newDB()
+		mustCreateUser(t, udb, newUser(1))
+		dup := newUser(2)
+		dup.Email = newUser(1).Email
+		if err := udb.Create(dup); err == nil {
+			t.Errorf("Create() with a taken email err = nil, want an error")
+		}
+	})
+
+	t.Run("remember hash must be unique", func(t *testing.T) {
+		udb := newDB()
+		mustCreateUser(t, udb, newUser(1))
+		dup := newUser(2)
+		dup.RememberHash = newUser(1).RememberHash
+		if err := udb.Create(dup); err == nil {
+			t.Errorf("Create() with a taken remember hash err = nil, want an error")
+		}
+	})
+
+	t.Run("update persists changes", func(t *testing.T) {
+		udb := newDB()
+		user := newUser(1)
+		mustCreateUser(t, udb, user)
+
+		user.Name = "Renamed"
+		user.Email = "renamed@example.com"
+		user.RememberHash = "rotated-hash"
+		user.Disabled = true
+		if err := udb.Update(user); err != nil {
+			t.Fatalf("Update() err = %v, want nil", err)
+		}
+
+		got, err := udb.ByRemember("rotated-hash")
+		if err != nil {
+			t.Fatalf("ByRemember() err = %v, want nil", err)
+		}
+		checkUser(t, "ByRemember", got, user)
+		if _, err := udb.ByRemember(newUser(1).RememberHash); err != models.ErrNotFound {
+			t.Errorf("ByRemember(old hash) err = %v, want %v", err, models.ErrNotFound)
+		}
+		if _, err := udb.ByEmail(newUser(1).Email); err != models.ErrNotFound {
+			t.Errorf("ByEmail(old email) err = %v, want %v", err, models.ErrNotFound)
+		}
+	})
+
+	t.Run("update without a password hash keeps it", func(t *testing.T) {
+		udb := newDB()
+		user := newUser(1)
+		mustCreateUser(t, udb, user)
+
+		update := *user
+		update.Name = "Renamed"
+		update.PasswordHash = ""
+		if err := udb.Update(&update); err != nil {
+			t.Fatalf("Update() err = %v, want nil", err)
+		}
+
+		got, err := udb.ByID(user.ID)
+		if err != nil {
+			t.Fatalf("ByID() err = %v, want nil", err)
+		}
+		if got.Name != "Renamed" {
+			t.Errorf("Name = %q, want %q", got.Name, "Renamed")
+		}
+		if got.PasswordHash != user.PasswordHash {
+			t.Errorf("PasswordHash = %q, want %q", got.PasswordHash, user.PasswordHash)
+		}
+	})
+
+	t.Run("returned users are copies", func(t *testing.T) {
+		udb := newDB()
+		user := newUser(1)
+		mustCreateUser(t, udb, user)
+
+		got, err := udb.ByID(user.ID)
+		if err != nil {
+			t.Fatalf("ByID() err = %v, want nil", err)
+		}
+		got.Name = "Changed without Update"
+		again, err := udb.ByID(user.ID)
+		if err != nil {
+			t.Fatalf("ByID() err = %v, want nil", err)
+		}
+		if again.Name != user.Name {
+			t.Errorf("Name = %q after changing a returned user, want %q", again.Name, user.Name)
+		}
+	})
+
+	t.Run("deleted users are not found", func(t *testing.T) {
+		udb := newDB()
+		user := newUser(1)
+		other := newUser(2)
+		mustCreateUser(t, udb, user)
+		mustCreateUser(t, udb, other)
+		if err := udb.Delete(user.ID); err != nil {
+			t.Fatalf("Delete() err = %v, want nil", err)
+		}
+		if _, err := udb.ByID(user.ID); err != models.ErrNotFound {
+			t.Errorf("ByID() err = %v, want %v", err, models.ErrNotFound)
+		}
+		if _, err := udb.ByEmail(user.Email); err != models.ErrNotFound {
+			t.Errorf("ByEmail() err = %v, want %v", err, models.ErrNotFound)
+		}
+		if _, err := udb.ByID(other.ID); err != nil {
+			t.Errorf("ByID(other user) err = %v, want nil", err)
+		}
+	})
+
+	t.Run("all lists users by ID", func(t *testing.T) {
+		udb := newDB()
+		var ids []uint
+		for i := 1; i <= 3; i++ {
+			u := newUser(i)
+			mustCreateUser(t, udb, u)
+			ids = append(ids, u.ID)
+		}
+		if err := udb.Delete(ids[1]); err != nil {
+			t.Fatalf("Delete() err = %v, want nil", err)
+		}
+
+		users, err := udb.All()
+		if err != nil {
+			t.Fatalf("All() err = %v, want nil", err)
+		}
+		var got []uint
+		for _, u := range users {
+			got = append(got, u.ID)
+		}
+		want := []uint{ids[0], ids[2]}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("All() IDs = %v, want %v", got, want)
+		}
+	})
+}
+
+// TestGalleryDB runs the GalleryDB conformance suite. newDB is called
+// once per subtest and must return an empty GalleryDB.
+func TestGalleryDB(t *testing.T, newDB func() models.GalleryDB) {
+	t.Run("lookups of missing galleries", func(t *testing.T) {
+		gdb := newDB()
+		if _, err := gdb.ByID(42); err != models.ErrNotFound {
+			t.Errorf("ByID() err = %v, want %v", err, models.ErrNotFound)
+		}
+		galleries, err := gdb.ByUserID(42)
+		if err != nil || len(galleries) != 0 {
+			t.Errorf("ByUserID() = %v, %v; want no galleries and nil", galleries, err)
+		}
+	})
+
+	t.Run("create assigns an ID and the gallery can be found", func(t *testing.T) {
+		gdb := newDB()
+		want := &models.Gallery{UserID: 1, Title: "Holidays"}
+		mustCreateGallery(t, gdb, want)
+		if want.ID == 0 || want.CreatedAt.IsZero() {
+			t.Fatalf("ID = %d, CreatedAt = %v; want both set", want.ID, want.CreatedAt)
+		}
+
+		got, err := gdb.ByID(want.ID)
+		if err != nil {
+			t.Fatalf("ByID() err = %v, want nil", err)
+		}
+		if got.ID != want.ID || got.UserID != want.UserID || got.Title != want.Title {
+			t.Errorf("ByID() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("galleries by user", func(t *testing.T) {
+		gdb := newDB()
+		for _, g := range []*models.Gallery{
+			{UserID: 1, Title: "A"},
+			{UserID: 2, Title: "B"},
+			{UserID: 1, Title: "C"},
+		} {
+			mustCreateGallery(t, gdb, g)
+		}
+
+		galleries, err := gdb.ByUserID(1)
+		if err != nil {
+			t.Fatalf("ByUserID() err = %v, want nil", err)
+		}
+		titles := map[string]bool{}
+		for _, g := range galleries {
+			if g.UserID != 1 {
+				t.Errorf("ByUserID(1) returned gallery %d of user %d", g.ID, g.UserID)
+			}
+			titles[g.Title] = true
+		}
+		if len(galleries) != 2 || !titles["A"] || !titles["C"] {
+			t.Errorf("ByUserID(1) = %+v, want galleries A and C", galleries)
+		}
+
+		all, err := gdb.All()
+		if err != nil {
+			t.Fatalf("All() err = %v, want nil", err)
+		}
+		if len(all) != 3 || all[0].Title != "A" || all[2].Title != "C" {
+			t.Errorf("All() = %+v, want A, B and C in order", all)
+		}
+	})
+
+	t.Run("update persists changes", func(t *testing.T) {
+		gdb := newDB()
+		g := &models.Gallery{UserID: 1, Title: "Before"}
+		mustCreateGallery(t, gdb, g)
+
+		g.Title = "After"
+		g.UserID = 2
+		if err := gdb.Update(g); err != nil {
+			t.Fatalf("Update() err = %v, want nil", err)
+		}
+		got, err := gdb.ByID(g.ID)
+		if err != nil {
+			t.Fatalf("ByID() err = %v, want nil", err)
+		}
+		if got.Title != "After" || got.UserID != 2 {
+			t.Errorf("ByID() = %+v, want title After and user 2", got)
+		}
+		if old, _ := gdb.ByUserID(1); len(old) != 0 {
+			t.Errorf("ByUserID(previous owner) = %+v, want none", old)
+		}
+	})
+
+	t.Run("deleted galleries are not found", func(t *testing.T) {
+		gdb := newDB()
+		g := &models.Gallery{UserID: 1, Title: "Gone"}
+		mustCreateGallery(t, gdb, g)
+		if err := gdb.Delete(g.ID); err != nil {
+			t.Fatalf("Delete() err = %v, want nil", err)
+		}
+		if _, err := gdb.ByID(g.ID); err != models.ErrNotFound {
+			t.Errorf("ByID() err = %v, want %v", err, models.ErrNotFound)
+		}
+		if galleries, _ := gdb.ByUserID(1); len(galleries) != 0 {
+			t.Errorf("ByUserID() = %+v, want none", galleries)
+		}
+	})
+}
+
+// newUser returns the n-th test user, as the validation layer would
+// pass it on to storage
+func newUser(n int) *models.User {
+	return &models.User{
+		Name:         fmt.Sprintf("User %d", n),
+		Email:        fmt.Sprintf("user%d@example.com", n),
+		PasswordHash: fmt.Sprintf("password-hash-%d", n),
+		RememberHash: fmt.Sprintf("remember-hash-%d", n),
+	}
+}
+
+func mustCreateUser(t *testing.T, udb models.UserDB, user *models.User) {
+	t.Helper()
+	if err := udb.Create(user); err != nil {
+		t.Fatalf("Create(%s) err = %v, want nil", user.Email, err)
+	}
+}
+
+func mustCreateGallery(t *testing.T, gdb models.GalleryDB, gallery *models.Gallery) {
+	t.Helper()
+	if err := gdb.Create(gallery); err != nil {
+		t.Fatalf("Create(%s) err = %v, want nil", gallery.Title, err)
+	}
+}
+
+// checkUser compares the stored fields of got and want
+func checkUser(t *testing.T, lookup string, got, want *models.User) {
+	t.Helper()
+	if got.ID != want.ID ||
+		got.Name != want.Name ||
+		got.Email != want.Email ||
+		got.PasswordHash != want.PasswordHash ||
+		got.RememberHash != want.RememberHash ||
+		got.Admin != want.Admin ||
+		got.Disabled != want.Disabled {
+		t.Errorf("%s() = %+v, want %+v", lookup, got, want)
+	}
+}
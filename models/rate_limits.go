@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/nahuakang/gophotos/ratelimit"
+)
+
+// RateLimitBucket is a token bucket stored in the database so that
+// every instance of the app shares the same rate limits.
+type RateLimitBucket struct {
+	Key       string `gorm:"primary_key"`
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Ensure rateLimitGorm implements ratelimit.Store interface
+var _ ratelimit.Store = &rateLimitGorm{}
+
+type rateLimitGorm struct {
+	db *gorm.DB
+}
+
+// Take implements ratelimit.Store. On Postgres the bucket row is
+// locked for the duration of the transaction so concurrent requests
+// from other instances cannot take the same token; SQLite has a single
+// writer, which serializes the transactions already.
+func (rg *rateLimitGorm) Take(key string, limit ratelimit.Limit, now time.Time) (bool, time.Duration, error) {
+	tx := rg.db.Begin()
+	if tx.Error != nil {
+		return false, 0, tx.Error
+	}
+	defer tx.Rollback()
+
+	err := tx.Exec(
+		"INSERT INTO rate_limit_buckets (key, tokens, updated_at) "+
+			"VALUES (?, ?, ?) ON CONFLICT (key) DO NOTHING",
+		key, limit.Burst, now,
+	).Error
+	if err != nil {
+		return false, 0, err
+	}
+
+	query := tx.Where("key = ?", key)
+	if tx.Dialect().GetName() == "postgres" {
+		query = query.Set("gorm:query_option", "FOR UPDATE")
+	}
+	var b RateLimitBucket
+	err = query.First(&b).Error
+	if err != nil {
+		return false, 0, err
+	}
+
+	tokens := ratelimit.Refill(b.Tokens, b.UpdatedAt, now, limit)
+	ok := tokens >= 1
+	if ok {
+		tokens--
+	}
+
+	// UpdateColumns rather than Updates, which would overwrite
+	// updated_at with the current time instead of now
+	err = tx.Model(&b).UpdateColumns(map[string]interface{}{
+		"tokens":     tokens,
+		"updated_at": now,
+	}).Error
+	if err != nil {
+		return false, 0, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, 0, err
+	}
+
+	if !ok {
+		return false, ratelimit.RetryAfter(tokens, limit), nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/nahuakang/gophotos/cache"
+	"github.com/nahuakang/gophotos/logger"
+	"github.com/nahuakang/gophotos/migrations"
+)
+
+// newLaggingReplica returns a migrated primary and replica, two
+// separate in-memory SQLite databases, so writes to the primary never
+// reach the replica
+func newLaggingReplica(t *testing.T) (primary, replica *gorm.DB) {
+	t.Helper()
+	dbs := make([]*gorm.DB, 2)
+	for i := range dbs {
+		db, err := openGorm("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatalf("opening SQLite: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		m, err := migrations.New(db.DB(), "sqlite3")
+		if err != nil {
+			t.Fatalf("migrations.New() err = %v", err)
+		}
+		if _, err := m.Up(context.Background()); err != nil {
+			t.Fatalf("migrating: %v", err)
+		}
+		dbs[i] = db
+	}
+	return dbs[0], dbs[1]
+}
+
+func TestGalleryByIDPrimary(t *testing.T) {
+	primary, replica := newLaggingReplica(t)
+	// The replica has yet to see the rename and the new owner
+	stale := Gallery{UserID: 1, Title: "Dundies 2005"}
+	if err := replica.Create(&stale).Error; err != nil {
+		t.Fatal(err)
+	}
+	current := Gallery{Model: gorm.Model{ID: stale.ID}, UserID: 2, Title: "Dundies 2006"}
+	if err := primary.Create(&current).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gs := newGalleryService(&galleryGorm{db: primary, replica: replica})
+	got, err := gs.ByID(stale.ID)
+	if err != nil {
+		t.Fatalf("ByID() err = %v, want nil", err)
+	}
+	if got.Title != stale.Title {
+		t.Errorf("ByID().Title = %q, want the replica's %q", got.Title, stale.Title)
+	}
+
+	got, err = gs.WithContext(context.Background()).ByIDPrimary(stale.ID)
+	if err != nil {
+		t.Fatalf("ByIDPrimary() err = %v, want nil", err)
+	}
+	if got.Title != current.Title || got.UserID != current.UserID {
+		t.Errorf("ByIDPrimary() = %q of user %d, want %q of user %d",
+			got.Title, got.UserID, current.Title, current.UserID)
+	}
+	if _, err := gs.ByIDPrimary(stale.ID + 1); err != ErrNotFound {
+		t.Errorf("ByIDPrimary() of a missing gallery err = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestUserByIDPrimary(t *testing.T) {
+	primary, replica := newLaggingReplica(t)
+	stale := User{Email: "dwight@dundermifflin.com", PasswordHash: "old", RememberHash: "old"}
+	if err := replica.Create(&stale).Error; err != nil {
+		t.Fatal(err)
+	}
+	current := User{
+		Model:        gorm.Model{ID: stale.ID},
+		Email:        stale.Email,
+		PasswordHash: "new",
+		RememberHash: "new",
+		Disabled:     true,
+	}
+	if err := primary.Create(&current).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	udb := newUserCache(&userGorm{db: primary, replica: replica}, cache.NewLRU(10), time.Minute, logger.New(io.Discard))
+	us := newUserService(udb, "pepper", "hmac-key")
+	// Cache the stale user
+	if got, err := us.ByID(stale.ID); err != nil || got.Disabled {
+		t.Fatalf("ByID() = %+v, %v, want the replica's enabled user", got, err)
+	}
+
+	got, err := us.WithContext(context.Background()).ByIDPrimary(stale.ID)
+	if err != nil {
+		t.Fatalf("ByIDPrimary() err = %v, want nil", err)
+	}
+	if !got.Disabled || got.PasswordHash != "new" {
+		t.Errorf("ByIDPrimary() = %+v, want the primary's disabled user", got)
+	}
+}
@@ -1,46 +1,350 @@
 package models
 
-import "github.com/jinzhu/gorm"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
 
-// NewServices returns a single copy of services needed for the web app
-func NewServices(connectionInfo string) (*Services, error) {
-	db, err := gorm.Open("postgres", connectionInfo)
-	if err != nil {
-		return nil, err
+	"github.com/jinzhu/gorm"
+	"github.com/nahuakang/gophotos/cache"
+	"github.com/nahuakang/gophotos/logger"
+	"github.com/nahuakang/gophotos/migrations"
+	"github.com/nahuakang/gophotos/ratelimit"
+)
+
+// ServicesConfig is a functional option used to configure Services
+// in NewServices. Options are applied in the order they are given,
+// so WithGorm must come before any option that needs the database.
+type ServicesConfig func(*Services) error
+
+// WithGorm opens the database connection used by the services.
+// dialect is "postgres" or "sqlite3"; for SQLite connectionInfo is a
+// file path or ":memory:".
+func WithGorm(dialect, connectionInfo string) ServicesConfig {
+	return func(s *Services) error {
+		db, err := openGorm(dialect, connectionInfo)
+		if err != nil {
+			return err
+		}
+		s.db = db
+		s.replica = db
+		s.applyLogging()
+		return nil
+	}
+}
+
+// WithReplica opens a read-only replica of the database, with the same
+// dialect as WithGorm. Lookups and listings that can tolerate a little
+// replication lag are sent to it; writes and everything else go to
+// the primary. It must come after WithGorm and before the options
+// setting up the services.
+func WithReplica(connectionInfo string) ServicesConfig {
+	return func(s *Services) error {
+		db, err := openGorm(s.db.Dialect().GetName(), connectionInfo)
+		if err != nil {
+			return fmt.Errorf("opening replica: %v", err)
+		}
+		s.replica = db
+		s.applyLogging()
+		return s.applyPool()
+	}
+}
+
+// Pool holds the connection pool settings for WithPool. Zero values
+// keep the database/sql defaults.
+type Pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// WithPool configures the connection pools of the primary and the
+// replica. SQLite always uses a single connection.
+func WithPool(p Pool) ServicesConfig {
+	return func(s *Services) error {
+		s.pool = p
+		return s.applyPool()
+	}
+}
+
+// WithLogger sets the logger used by the services and for SQL logging
+func WithLogger(lg *logger.Logger) ServicesConfig {
+	return func(s *Services) error {
+		s.logger = lg
+		s.applyLogging()
+		return nil
+	}
+}
+
+// WithLogMode turns logging of every SQL statement on or off. Errors
+// are always logged.
+func WithLogMode(mode bool) ServicesConfig {
+	return func(s *Services) error {
+		s.logSQL = mode
+		s.applyLogging()
+		return nil
 	}
+}
+
+// WithSlowQueryLog logs only the SQL statements that take at least
+// threshold, along with errors
+func WithSlowQueryLog(threshold time.Duration) ServicesConfig {
+	return func(s *Services) error {
+		s.logSQL = true
+		s.slowQuery = threshold
+		s.applyLogging()
+		return nil
+	}
+}
+
+// WithUserCache caches user lookups by ID and remember token in store
+// for ttl, which saves a query on every request of a signed in user.
+// It must come before WithUser.
+func WithUserCache(store cache.Store, ttl time.Duration) ServicesConfig {
+	return func(s *Services) error {
+		s.userCache = store
+		s.userCacheTTL = ttl
+		return nil
+	}
+}
 
-	db.LogMode(true)
+// WithUser sets up the UserService with the password pepper and the
+// key used to hash remember tokens
+func WithUser(pepper, hmacKey string) ServicesConfig {
+	return func(s *Services) error {
+		var udb UserDB = &userGorm{db: s.db, replica: s.replica}
+		if s.userCache != nil {
+			udb = newUserCache(udb, s.userCache, s.userCacheTTL, s.logger)
+		}
+		s.User = newUserService(udb, pepper, hmacKey)
+		return nil
+	}
+}
 
-	return &Services{
-		User:    NewUserService(db),
-		Gallery: NewGalleryService(db),
-		db:      db,
-	}, nil
+// WithGallery sets up the GalleryService
+func WithGallery() ServicesConfig {
+	return func(s *Services) error {
+		s.Gallery = newGalleryService(&galleryGorm{db: s.db, replica: s.replica})
+		return nil
+	}
+}
+
+// WithAudit sets up the AuditService
+func WithAudit() ServicesConfig {
+	return func(s *Services) error {
+		s.Audit = NewAuditService(s.db)
+		return nil
+	}
+}
+
+// WithRateLimit sets up a database backed rate limit store, for
+// deployments running more than one instance of the app
+func WithRateLimit() ServicesConfig {
+	return func(s *Services) error {
+		s.RateLimit = &rateLimitGorm{db: s.db}
+		return nil
+	}
+}
+
+// NewServices returns a single copy of services needed for the web app
+func NewServices(cfgs ...ServicesConfig) (*Services, error) {
+	s := Services{
+		logger: logger.Default(),
+	}
+	for _, cfg := range cfgs {
+		if err := cfg(&s); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
 }
 
 // Services represents all the services, e.g. GalleryService, UserService
 type Services struct {
-	Gallery GalleryService
-	User    UserService
-	db      *gorm.DB
+	Gallery   GalleryService
+	User      UserService
+	Audit     AuditService
+	RateLimit ratelimit.Store
+	db        *gorm.DB
+	// replica is the same as db unless WithReplica is used
+	replica   *gorm.DB
+	pool      Pool
+	logger    *logger.Logger
+	logSQL    bool
+	slowQuery time.Duration
+	// userCache, if set, is wrapped around the users table
+	userCache    cache.Store
+	userCacheTTL time.Duration
 }
 
-// Close closes the database connection from Services layer
+// Close closes the database connections from Services layer
 func (s *Services) Close() error {
+	if c, ok := s.userCache.(io.Closer); ok {
+		c.Close()
+	}
+	if s.replica != s.db {
+		if err := s.replica.Close(); err != nil {
+			s.db.Close()
+			return err
+		}
+	}
 	return s.db.Close()
 }
 
-// AutoMigrate automigrates all tables for Services.db
-func (s *Services) AutoMigrate() error {
-	return s.db.AutoMigrate(&User{}, &Gallery{}).Error
+// Ping checks that the database, and the replica if there is one, can
+// be reached
+func (s *Services) Ping(ctx context.Context) error {
+	if err := s.db.DB().PingContext(ctx); err != nil {
+		return err
+	}
+	if s.replica != s.db {
+		if err := s.replica.DB().PingContext(ctx); err != nil {
+			return fmt.Errorf("replica: %v", err)
+		}
+	}
+	return nil
+}
+
+// DBStats returns the connection pool statistics of the database,
+// keyed by "primary" and, if there is one, "replica"
+func (s *Services) DBStats() map[string]sql.DBStats {
+	stats := map[string]sql.DBStats{"primary": s.db.DB().Stats()}
+	if s.replica != s.db {
+		stats["replica"] = s.replica.DB().Stats()
+	}
+	return stats
+}
+
+// openGorm opens a database connection
+func openGorm(dialect, connectionInfo string) (*gorm.DB, error) {
+	db, err := gorm.Open(dialect, connectionInfo)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == "sqlite3" {
+		// SQLite allows a single writer, and every connection to
+		// ":memory:" would get a database of its own
+		db.DB().SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// applyLogging sets up SQL logging on the open connections
+func (s *Services) applyLogging() {
+	for _, db := range s.dbs() {
+		// gorm's own log modes either log every statement or
+		// nothing at all, errors included, so statements are
+		// filtered in gormLogger instead
+		db.SetLogger(gormLogger{lg: s.logger, statements: s.logSQL, slow: s.slowQuery})
+		db.LogMode(true)
+	}
+}
+
+// applyPool sets the connection pool limits on the open connections
+func (s *Services) applyPool() error {
+	for _, db := range s.dbs() {
+		sqlDB := db.DB()
+		if s.pool.MaxOpenConns > 0 && db.Dialect().GetName() != "sqlite3" {
+			sqlDB.SetMaxOpenConns(s.pool.MaxOpenConns)
+		}
+		if s.pool.MaxIdleConns > 0 {
+			sqlDB.SetMaxIdleConns(s.pool.MaxIdleConns)
+		}
+		if s.pool.ConnMaxLifetime > 0 {
+			sqlDB.SetConnMaxLifetime(s.pool.ConnMaxLifetime)
+		}
+		if s.pool.ConnMaxIdleTime > 0 {
+			sqlDB.SetConnMaxIdleTime(s.pool.ConnMaxIdleTime)
+		}
+	}
+	return nil
+}
+
+// dbs returns the distinct open connections
+func (s *Services) dbs() []*gorm.DB {
+	switch {
+	case s.db == nil:
+		return nil
+	case s.replica == nil || s.replica == s.db:
+		return []*gorm.DB{s.db}
+	default:
+		return []*gorm.DB{s.db, s.replica}
+	}
+}
+
+// Migrator returns the schema migrator for Services.db
+func (s *Services) Migrator() (*migrations.Migrator, error) {
+	return migrations.New(s.db.DB(), s.db.Dialect().GetName())
 }
 
 // DestructiveReset drops all tables and rebuilds them
+// by running every migration again
 func (s *Services) DestructiveReset() error {
-	err := s.db.DropTableIfExists(&User{}, &Gallery{}).Error
+	err := s.db.DropTableIfExists(
+		&User{}, &Gallery{}, &AuditEntry{}, &RateLimitBucket{}, "schema_migrations",
+	).Error
+	if err != nil {
+		return err
+	}
+
+	m, err := s.Migrator()
 	if err != nil {
 		return err
 	}
+	_, err = m.Up(context.Background())
+	return err
+}
 
-	return s.AutoMigrate()
+// gormLogger sends gorm's log output to a structured logger.
+// Query arguments are deliberately left out since they can contain
+// password and remember token hashes.
+type gormLogger struct {
+	lg *logger.Logger
+	// statements turns on logging of SQL statements; errors are
+	// always logged
+	statements bool
+	// slow, if set, leaves out statements faster than it
+	slow time.Duration
+}
+
+// Print implements gorm.logger. gorm passes the log type ("sql",
+// "error" or "log") followed by the source file and line; "sql"
+// entries then have the duration, statement, args and rows affected.
+func (gl gormLogger) Print(values ...interface{}) {
+	if len(values) < 2 {
+		return
+	}
+
+	switch values[0] {
+	case "sql":
+		if len(values) < 6 {
+			return
+		}
+		d, _ := values[2].(time.Duration)
+		if !gl.statements || d < gl.slow {
+			return
+		}
+		ms := float64(d.Microseconds()) / 1000
+		gl.lg.Debug("sql",
+			"source", values[1],
+			"duration_ms", ms,
+			"statement", values[3],
+			"rows", values[5],
+		)
+	case "error":
+		gl.lg.Error("gorm", "source", values[1], "error", fmt.Sprint(values[2:]...))
+	default:
+		// gorm reports errors as "log" entries when logging
+		// statements
+		if len(values) == 3 {
+			if err, ok := values[2].(error); ok {
+				gl.lg.Error("gorm", "source", values[1], "error", err)
+				return
+			}
+		}
+		gl.lg.Info("gorm", "source", values[1], "values", fmt.Sprint(values[2:]...))
+	}
 }
@@ -0,0 +1,199 @@
+package models_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nahuakang/gophotos/models"
+	"github.com/nahuakang/gophotos/ratelimit"
+)
+
+// newSQLiteServices returns every service on a fully migrated
+// in-memory SQLite database that is closed when the test ends
+func newSQLiteServices(t *testing.T) *models.Services {
+	t.Helper()
+	services, err := models.NewServices(
+		models.WithGorm("sqlite3", ":memory:"),
+		models.WithUser("test-pepper", "test-hmac-key"),
+		models.WithGallery(),
+		models.WithAudit(),
+		models.WithRateLimit(),
+	)
+	if err != nil {
+		t.Fatalf("NewServices() err = %v", err)
+	}
+	t.Cleanup(func() { services.Close() })
+
+	m, err := services.Migrator()
+	if err != nil {
+		t.Fatalf("Migrator() err = %v", err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return services
+}
+
+func TestSQLiteServices(t *testing.T) {
+	services := newSQLiteServices(t)
+	if err := services.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() err = %v, want nil", err)
+	}
+
+	m, err := services.Migrator()
+	if err != nil {
+		t.Fatalf("Migrator() err = %v", err)
+	}
+	pending, err := m.Pending(context.Background())
+	if err != nil {
+		t.Fatalf("Pending() err = %v, want nil", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Pending() = %d migrations after Up, want none", len(pending))
+	}
+
+	user := models.User{
+		Name:     "Michael Scott",
+		Email:    "Michael@DunderMifflin.com",
+		Password: "worldsbestboss",
+	}
+	if err := services.User.Create(&user); err != nil {
+		t.Fatalf("User.Create() err = %v, want nil", err)
+	}
+	if _, err := services.User.Authenticate("michael@dundermifflin.com", "worldsbestboss"); err != nil {
+		t.Errorf("Authenticate() err = %v, want nil", err)
+	}
+	got, err := services.User.ByRemember(user.Remember)
+	if err != nil {
+		t.Fatalf("ByRemember() err = %v, want nil", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("ByRemember().ID = %d, want %d", got.ID, user.ID)
+	}
+
+	gallery := models.Gallery{UserID: user.ID, Title: "Dundies"}
+	if err := services.Gallery.Create(&gallery); err != nil {
+		t.Fatalf("Gallery.Create() err = %v, want nil", err)
+	}
+	galleries, err := services.Gallery.ByUserID(user.ID)
+	if err != nil {
+		t.Fatalf("Gallery.ByUserID() err = %v, want nil", err)
+	}
+	if len(galleries) != 1 || galleries[0].Title != "Dundies" {
+		t.Errorf("Gallery.ByUserID() = %+v, want the Dundies gallery", galleries)
+	}
+}
+
+func TestSQLiteDumpRestore(t *testing.T) {
+	src := newSQLiteServices(t)
+	var users []models.User
+	for _, email := range []string{"michael@dundermifflin.com", "dwight@dundermifflin.com", "jim@dundermifflin.com"} {
+		user := models.User{Name: email, Email: email, Password: "password123"}
+		if err := src.User.Create(&user); err != nil {
+			t.Fatalf("User.Create() err = %v, want nil", err)
+		}
+		users = append(users, user)
+	}
+	// Deleted records leave gaps in the IDs and are dumped too
+	if err := src.User.Delete(users[1].ID); err != nil {
+		t.Fatalf("User.Delete() err = %v, want nil", err)
+	}
+	for _, title := range []string{"Dundies", "Beet farm"} {
+		gallery := models.Gallery{UserID: users[0].ID, Title: title}
+		if err := src.Gallery.Create(&gallery); err != nil {
+			t.Fatalf("Gallery.Create() err = %v, want nil", err)
+		}
+	}
+	if err := src.Gallery.Delete(1); err != nil {
+		t.Fatalf("Gallery.Delete() err = %v, want nil", err)
+	}
+	err := src.Audit.Record(&models.AuditEntry{
+		ActorID:    users[0].ID,
+		Action:     models.AuditUserCreate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   users[0].ID,
+	})
+	if err != nil {
+		t.Fatalf("Audit.Record() err = %v, want nil", err)
+	}
+
+	dump, err := src.Dump()
+	if err != nil {
+		t.Fatalf("Dump() err = %v, want nil", err)
+	}
+	if len(dump.Users) != 3 || len(dump.Galleries) != 2 || len(dump.AuditEntries) != 1 {
+		t.Fatalf("Dump() has %d users, %d galleries and %d audit entries, want 3, 2 and 1",
+			len(dump.Users), len(dump.Galleries), len(dump.AuditEntries))
+	}
+
+	dst := newSQLiteServices(t)
+	if err := dst.Restore(dump); err != nil {
+		t.Fatalf("Restore() err = %v, want nil", err)
+	}
+	restored, err := dst.Dump()
+	if err != nil {
+		t.Fatalf("Dump() of the restored database err = %v, want nil", err)
+	}
+	if !reflect.DeepEqual(restored, dump) {
+		t.Errorf("restored records differ:\ngot  %+v\nwant %+v", restored, dump)
+	}
+
+	// The restored users can sign in, and new records get new IDs
+	if _, err := dst.User.Authenticate(users[2].Email, "password123"); err != nil {
+		t.Errorf("Authenticate() on the restored database err = %v, want nil", err)
+	}
+	user := models.User{Name: "Pam", Email: "pam@dundermifflin.com", Password: "password123"}
+	if err := dst.User.Create(&user); err != nil {
+		t.Fatalf("User.Create() on the restored database err = %v, want nil", err)
+	}
+	if user.ID <= users[2].ID {
+		t.Errorf("new user ID = %d, want it after the restored %d", user.ID, users[2].ID)
+	}
+
+	if err := dst.Restore(dump); err != models.ErrNotEmpty {
+		t.Errorf("Restore() into a non-empty database err = %v, want %v", err, models.ErrNotEmpty)
+	}
+}
+
+func TestSQLiteRateLimitStore(t *testing.T) {
+	store := newSQLiteServices(t).RateLimit
+	limit := ratelimit.Limit{Rate: 1, Burst: 2}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	take := func(key string, at time.Time) (bool, time.Duration) {
+		t.Helper()
+		ok, retryAfter, err := store.Take(key, limit, at)
+		if err != nil {
+			t.Fatalf("Take(%q) err = %v, want nil", key, err)
+		}
+		return ok, retryAfter
+	}
+
+	for i := 0; i < limit.Burst; i++ {
+		if ok, _ := take("login:ip:1.2.3.4", now); !ok {
+			t.Fatalf("Take() #%d within the burst was refused", i+1)
+		}
+	}
+	ok, retryAfter := take("login:ip:1.2.3.4", now)
+	if ok {
+		t.Fatalf("Take() over the burst was allowed")
+	}
+	if retryAfter != time.Second {
+		t.Errorf("retryAfter = %v, want %v", retryAfter, time.Second)
+	}
+
+	// Other keys have buckets of their own
+	if ok, _ := take("login:ip:5.6.7.8", now); !ok {
+		t.Errorf("Take() for another key was refused")
+	}
+
+	// Refused requests don't use up tokens, so a second refills one
+	if ok, _ := take("login:ip:1.2.3.4", now.Add(time.Second)); !ok {
+		t.Errorf("Take() after refilling was refused")
+	}
+	if ok, _ := take("login:ip:1.2.3.4", now.Add(time.Second)); ok {
+		t.Errorf("Take() after using the refilled token was allowed")
+	}
+}
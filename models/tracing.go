@@ -0,0 +1,160 @@
+package models
+
+import (
+	"context"
+
+	"github.com/nahuakang/gophotos/trace"
+)
+
+// tracedUserService records a span for every call of the UserService
+// it wraps, as a child of the span in ctx. Only IDs are recorded;
+// emails, passwords and tokens stay out of traces.
+type tracedUserService struct {
+	UserService
+	ctx context.Context
+}
+
+func (tu *tracedUserService) WithContext(ctx context.Context) UserService {
+	return &tracedUserService{UserService: tu.UserService, ctx: ctx}
+}
+
+func (tu *tracedUserService) Authenticate(email, password string) (*User, error) {
+	_, span := trace.Start(tu.ctx, "UserService.Authenticate")
+	user, err := tu.UserService.Authenticate(email, password)
+	endSpan(span, err)
+	return user, err
+}
+
+func (tu *tracedUserService) ByID(id uint) (*User, error) {
+	_, span := trace.Start(tu.ctx, "UserDB.ByID", "user.id", id)
+	user, err := tu.UserService.ByID(id)
+	endSpan(span, err)
+	return user, err
+}
+
+func (tu *tracedUserService) ByIDPrimary(id uint) (*User, error) {
+	_, span := trace.Start(tu.ctx, "UserService.ByIDPrimary", "user.id", id)
+	user, err := tu.UserService.ByIDPrimary(id)
+	endSpan(span, err)
+	return user, err
+}
+
+func (tu *tracedUserService) ByEmail(email string) (*User, error) {
+	_, span := trace.Start(tu.ctx, "UserDB.ByEmail")
+	user, err := tu.UserService.ByEmail(email)
+	endSpan(span, err)
+	return user, err
+}
+
+func (tu *tracedUserService) ByRemember(token string) (*User, error) {
+	_, span := trace.Start(tu.ctx, "UserDB.ByRemember")
+	user, err := tu.UserService.ByRemember(token)
+	endSpan(span, err)
+	return user, err
+}
+
+func (tu *tracedUserService) All() ([]User, error) {
+	_, span := trace.Start(tu.ctx, "UserDB.All")
+	users, err := tu.UserService.All()
+	span.SetAttributes("users", len(users))
+	endSpan(span, err)
+	return users, err
+}
+
+func (tu *tracedUserService) Create(user *User) error {
+	_, span := trace.Start(tu.ctx, "UserDB.Create")
+	err := tu.UserService.Create(user)
+	span.SetAttributes("user.id", user.ID)
+	endSpan(span, err)
+	return err
+}
+
+func (tu *tracedUserService) Update(user *User) error {
+	_, span := trace.Start(tu.ctx, "UserDB.Update", "user.id", user.ID)
+	err := tu.UserService.Update(user)
+	endSpan(span, err)
+	return err
+}
+
+func (tu *tracedUserService) Delete(id uint) error {
+	_, span := trace.Start(tu.ctx, "UserDB.Delete", "user.id", id)
+	err := tu.UserService.Delete(id)
+	endSpan(span, err)
+	return err
+}
+
+// tracedGalleryService records a span for every call of the
+// GalleryService it wraps, as a child of the span in ctx
+type tracedGalleryService struct {
+	GalleryService
+	ctx context.Context
+}
+
+func (tg *tracedGalleryService) WithContext(ctx context.Context) GalleryService {
+	return &tracedGalleryService{GalleryService: tg.GalleryService, ctx: ctx}
+}
+
+func (tg *tracedGalleryService) ByID(id uint) (*Gallery, error) {
+	_, span := trace.Start(tg.ctx, "GalleryDB.ByID", "gallery.id", id)
+	gallery, err := tg.GalleryService.ByID(id)
+	endSpan(span, err)
+	return gallery, err
+}
+
+func (tg *tracedGalleryService) ByIDPrimary(id uint) (*Gallery, error) {
+	_, span := trace.Start(tg.ctx, "GalleryService.ByIDPrimary", "gallery.id", id)
+	gallery, err := tg.GalleryService.ByIDPrimary(id)
+	endSpan(span, err)
+	return gallery, err
+}
+
+func (tg *tracedGalleryService) ByUserID(userID uint) ([]Gallery, error) {
+	_, span := trace.Start(tg.ctx, "GalleryDB.ByUserID", "user.id", userID)
+	galleries, err := tg.GalleryService.ByUserID(userID)
+	span.SetAttributes("galleries", len(galleries))
+	endSpan(span, err)
+	return galleries, err
+}
+
+func (tg *tracedGalleryService) All() ([]Gallery, error) {
+	_, span := trace.Start(tg.ctx, "GalleryDB.All")
+	galleries, err := tg.GalleryService.All()
+	span.SetAttributes("galleries", len(galleries))
+	endSpan(span, err)
+	return galleries, err
+}
+
+func (tg *tracedGalleryService) Create(gallery *Gallery) error {
+	_, span := trace.Start(tg.ctx, "GalleryDB.Create", "user.id", gallery.UserID)
+	err := tg.GalleryService.Create(gallery)
+	span.SetAttributes("gallery.id", gallery.ID)
+	endSpan(span, err)
+	return err
+}
+
+func (tg *tracedGalleryService) Update(gallery *Gallery) error {
+	_, span := trace.Start(tg.ctx, "GalleryDB.Update", "gallery.id", gallery.ID)
+	err := tg.GalleryService.Update(gallery)
+	endSpan(span, err)
+	return err
+}
+
+func (tg *tracedGalleryService) Delete(id uint) error {
+	_, span := trace.Start(tg.ctx, "GalleryDB.Delete", "gallery.id", id)
+	err := tg.GalleryService.Delete(id)
+	endSpan(span, err)
+	return err
+}
+
+// endSpan ends a span of a models call. ErrNotFound is an ordinary
+// answer rather than a failure, so it is only noted as an attribute.
+func endSpan(span *trace.Span, err error) {
+	switch err {
+	case nil:
+	case ErrNotFound:
+		span.SetAttributes("found", false)
+	default:
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/nahuakang/gophotos/cache"
+	"github.com/nahuakang/gophotos/logger"
+	"github.com/nahuakang/gophotos/metrics"
+)
+
+var userCacheLookupsTotal = metrics.NewCounterVec(
+	"gophotos_user_cache_lookups_total",
+	"User lookups answered by the user cache (hit) or the database (miss), by lookup: id or remember.",
+	"lookup", "result",
+)
+
+func init() {
+	metrics.Register(userCacheLookupsTotal)
+}
+
+// userCache is a UserDB that caches ByID and ByRemember results of
+// the UserDB it wraps. It sits between the validator and gorm, so it
+// only ever sees remember token hashes.
+//
+// Users are cached by ID. A remember token hash only maps to an ID,
+// and a hit counts only if the cached user still has that hash, so
+// dropping the user's entry on Update and Delete also ends sessions
+// whose token was rotated.
+//
+// Password hashes are never cached, so users served from the cache
+// have an empty PasswordHash. Update keeps the stored hash for them,
+// and Authenticate reads the primary, which bypasses the cache.
+type userCache struct {
+	UserDB
+	store  cache.Store
+	ttl    time.Duration
+	logger *logger.Logger
+}
+
+func newUserCache(udb UserDB, store cache.Store, ttl time.Duration, lg *logger.Logger) *userCache {
+	return &userCache{
+		UserDB: udb,
+		store:  store,
+		ttl:    ttl,
+		logger: lg,
+	}
+}
+
+// ByID returns the cached user or looks it up and caches it
+func (uc *userCache) ByID(id uint) (*User, error) {
+	if user, ok := uc.get(id); ok {
+		userCacheLookupsTotal.With("id", "hit").Inc()
+		return user, nil
+	}
+	userCacheLookupsTotal.With("id", "miss").Inc()
+
+	user, err := uc.UserDB.ByID(id)
+	if err != nil {
+		return nil, err
+	}
+	uc.set(user)
+	return user, nil
+}
+
+// ByRemember returns the cached user with the remember token hash or
+// looks them up and caches them
+func (uc *userCache) ByRemember(rememberHash string) (*User, error) {
+	key := "user:remember:" + rememberHash
+	if b, ok := uc.load(key); ok {
+		id, err := strconv.ParseUint(string(b), 10, 64)
+		if err == nil {
+			if user, ok := uc.get(uint(id)); ok && user.RememberHash == rememberHash {
+				userCacheLookupsTotal.With("remember", "hit").Inc()
+				return user, nil
+			}
+		}
+	}
+	userCacheLookupsTotal.With("remember", "miss").Inc()
+
+	user, err := uc.UserDB.ByRemember(rememberHash)
+	if err != nil {
+		return nil, err
+	}
+	uc.set(user)
+	uc.save(key, []byte(strconv.FormatUint(uint64(user.ID), 10)))
+	return user, nil
+}
+
+// Update updates the user and drops them from the cache
+func (uc *userCache) Update(user *User) error {
+	err := uc.UserDB.Update(user)
+	uc.drop(user.ID)
+	return err
+}
+
+// Delete deletes the user and drops them from the cache
+func (uc *userCache) Delete(id uint) error {
+	err := uc.UserDB.Delete(id)
+	uc.drop(id)
+	return err
+}
+
+// primary implements primaryReader. Lookups on the primary bypass the
+// cache too.
+func (uc *userCache) primary() UserDB {
+	if pr, ok := uc.UserDB.(primaryReader); ok {
+		return pr.primary()
+	}
+	return uc.UserDB
+}
+
+func userCacheKey(id uint) string {
+	return "user:id:" + strconv.FormatUint(uint64(id), 10)
+}
+
+func (uc *userCache) get(id uint) (*User, bool) {
+	b, ok := uc.load(userCacheKey(id))
+	if !ok {
+		return nil, false
+	}
+	var user User
+	if err := json.Unmarshal(b, &user); err != nil {
+		uc.logger.Error("decoding cached user", "user_id", id, "error", err)
+		return nil, false
+	}
+	return &user, true
+}
+
+func (uc *userCache) set(user *User) {
+	cached := *user
+	cached.PasswordHash = ""
+	b, err := json.Marshal(&cached)
+	if err != nil {
+		uc.logger.Error("encoding user for cache", "user_id", user.ID, "error", err)
+		return
+	}
+	uc.save(userCacheKey(user.ID), b)
+}
+
+// load and save treat cache errors as misses, since the database can
+// always answer instead
+func (uc *userCache) load(key string) ([]byte, bool) {
+	b, ok, err := uc.store.Get(key)
+	if err != nil {
+		uc.logger.Error("reading user cache", "error", err)
+		return nil, false
+	}
+	return b, ok
+}
+
+func (uc *userCache) save(key string, value []byte) {
+	if err := uc.store.Set(key, value, uc.ttl); err != nil {
+		uc.logger.Error("writing user cache", "error", err)
+	}
+}
+
+func (uc *userCache) drop(id uint) {
+	if err := uc.store.Delete(userCacheKey(id)); err != nil {
+		uc.logger.Error("invalidating user cache", "user_id", id, "error", err)
+	}
+}
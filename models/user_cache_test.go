@@ -0,0 +1,144 @@
+package models
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nahuakang/gophotos/cache"
+	"github.com/nahuakang/gophotos/logger"
+)
+
+// countingUserDB counts the lookups that reach the database
+type countingUserDB struct {
+	UserDB
+	lookups int
+}
+
+func (c *countingUserDB) ByID(id uint) (*User, error) {
+	c.lookups++
+	return c.UserDB.ByID(id)
+}
+
+func (c *countingUserDB) ByRemember(rememberHash string) (*User, error) {
+	c.lookups++
+	return c.UserDB.ByRemember(rememberHash)
+}
+
+func newTestUserCache(t *testing.T) (*userCache, *countingUserDB, *cache.LRU, *User) {
+	t.Helper()
+	db := &countingUserDB{UserDB: NewMemoryUserDB()}
+	user := &User{
+		Name:         "Michael Scott",
+		Email:        "michael@dundermifflin.com",
+		PasswordHash: "password-hash",
+		RememberHash: "remember-hash",
+	}
+	if err := db.Create(user); err != nil {
+		t.Fatalf("Create() err = %v, want nil", err)
+	}
+	store := cache.NewLRU(10)
+	return newUserCache(db, store, time.Minute, logger.New(io.Discard)), db, store, user
+}
+
+func TestUserCacheHits(t *testing.T) {
+	uc, db, _, user := newTestUserCache(t)
+
+	for i := 0; i < 2; i++ {
+		if _, err := uc.ByRemember(user.RememberHash); err != nil {
+			t.Fatalf("ByRemember() err = %v, want nil", err)
+		}
+		got, err := uc.ByID(user.ID)
+		if err != nil {
+			t.Fatalf("ByID() err = %v, want nil", err)
+		}
+		if got.Email != user.Email {
+			t.Errorf("ByID().Email = %q, want %q", got.Email, user.Email)
+		}
+	}
+	if db.lookups != 1 {
+		t.Errorf("database lookups = %d, want 1", db.lookups)
+	}
+}
+
+func TestUserCacheUpdateInvalidates(t *testing.T) {
+	uc, db, _, user := newTestUserCache(t)
+	if _, err := uc.ByID(user.ID); err != nil {
+		t.Fatalf("ByID() err = %v, want nil", err)
+	}
+
+	user.Name = "Prison Mike"
+	if err := uc.Update(user); err != nil {
+		t.Fatalf("Update() err = %v, want nil", err)
+	}
+	got, err := uc.ByID(user.ID)
+	if err != nil {
+		t.Fatalf("ByID() err = %v, want nil", err)
+	}
+	if got.Name != "Prison Mike" {
+		t.Errorf("ByID().Name after Update = %q, want %q", got.Name, "Prison Mike")
+	}
+	if db.lookups != 2 {
+		t.Errorf("database lookups = %d, want 2", db.lookups)
+	}
+}
+
+func TestUserCacheRotatedRememberMisses(t *testing.T) {
+	uc, _, _, user := newTestUserCache(t)
+	oldHash := user.RememberHash
+	if _, err := uc.ByRemember(oldHash); err != nil {
+		t.Fatalf("ByRemember() err = %v, want nil", err)
+	}
+
+	user.RememberHash = "rotated-hash"
+	if err := uc.Update(user); err != nil {
+		t.Fatalf("Update() err = %v, want nil", err)
+	}
+	if _, err := uc.ByRemember(oldHash); err != ErrNotFound {
+		t.Errorf("ByRemember(old hash) err = %v, want %v", err, ErrNotFound)
+	}
+
+	// Even once the user is cached again, the old hash still maps to
+	// their ID but no longer matches
+	if _, err := uc.ByID(user.ID); err != nil {
+		t.Fatalf("ByID() err = %v, want nil", err)
+	}
+	if _, err := uc.ByRemember(oldHash); err != ErrNotFound {
+		t.Errorf("ByRemember(old hash) with the user cached err = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := uc.ByRemember("rotated-hash"); err != nil {
+		t.Errorf("ByRemember(new hash) err = %v, want nil", err)
+	}
+}
+
+func TestUserCacheOmitsPasswordHash(t *testing.T) {
+	uc, db, store, user := newTestUserCache(t)
+	if _, err := uc.ByID(user.ID); err != nil {
+		t.Fatalf("ByID() err = %v, want nil", err)
+	}
+
+	b, ok, _ := store.Get(userCacheKey(user.ID))
+	if !ok {
+		t.Fatalf("user was not cached")
+	}
+	if strings.Contains(string(b), user.PasswordHash) {
+		t.Errorf("cached user %s contains the password hash", b)
+	}
+
+	// Saving a cached user keeps the stored password hash
+	cached, err := uc.ByID(user.ID)
+	if err != nil {
+		t.Fatalf("ByID() err = %v, want nil", err)
+	}
+	if err := uc.Update(cached); err != nil {
+		t.Fatalf("Update() err = %v, want nil", err)
+	}
+	got, err := db.UserDB.ByID(user.ID)
+	if err != nil {
+		t.Fatalf("ByID() err = %v, want nil", err)
+	}
+	if got.PasswordHash != user.PasswordHash {
+		t.Errorf("PasswordHash after updating a cached user = %q, want %q", got.PasswordHash, user.PasswordHash)
+	}
+}
@@ -1,21 +1,18 @@
 package models
 
 import (
+	"context"
 	"regexp"
 	"strings"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/nahuakang/gophotos/hash"
 	"github.com/nahuakang/gophotos/rand"
 	"golang.org/x/crypto/bcrypt"
 )
 
-const (
-	hmacSecretKey      = "secret-hmac-key"
-	userPasswordPepper = "secret-random-string"
-)
-
 type modelError string
 
 // Error ensures that modelError implements error interface
@@ -67,6 +64,9 @@ var (
 
 	// ErrRememberTooShort is returned when a remember token is not at least 32 bytes
 	ErrRememberTooShort modelError = "models: remember token must be at least 32 bytes"
+
+	// ErrUserDisabled is returned when a disabled user tries to sign in.
+	ErrUserDisabled modelError = "models: this account has been disabled"
 )
 
 // UserDB interacts with the users database.
@@ -82,17 +82,31 @@ type UserDB interface {
 	ByID(id uint) (*User, error)
 	ByEmail(email string) (*User, error)
 	ByRemember(token string) (*User, error)
+	// All returns every user, oldest first
+	All() ([]User, error)
 
 	// Methods for altering users
 	Create(user *User) error
+	// Update saves every field of user, except that an empty
+	// PasswordHash keeps the stored one
 	Update(user *User) error
 	Delete(id uint) error
 }
 
 // userGorm represents database interaction layer
-// and implements the UserDB interface fully.
+// and implements the UserDB interface fully. Writes go to db, while
+// lookups and listings go to replica, which is db itself unless the
+// services have a read replica.
 type userGorm struct {
-	db *gorm.DB
+	db      *gorm.DB
+	replica *gorm.DB
+}
+
+// primaryReader is implemented by UserDBs that may answer lookups
+// from a replica or a cache, to get a UserDB that always reads from
+// the primary database
+type primaryReader interface {
+	primary() UserDB
 }
 
 // UserService is an abstract layer to interact with gorm.DB
@@ -102,11 +116,22 @@ type UserService interface {
 	// email is returned. Otherwise, ErrNotFound, ErrPasswordIncorrect,
 	// or another error is returned.
 	Authenticate(email, password string) (*User, error)
+	// ByIDPrimary is ByID on the primary database, bypassing any
+	// replica or cache. Use it to look up a user that is about to be
+	// updated, since Update saves every field.
+	ByIDPrimary(id uint) (*User, error)
+	// WithContext returns a UserService that records a trace span
+	// under ctx for every call
+	WithContext(ctx context.Context) UserService
 	UserDB
 }
 
 type userService struct {
 	UserDB
+	// primary reads from the primary database even if UserDB reads
+	// from a replica, for lookups that must not be stale
+	primary UserDB
+	pepper  string
 }
 
 // userValidator is the validation layer that validates
@@ -115,6 +140,7 @@ type userService struct {
 type userValidator struct {
 	UserDB
 	hmac       hash.HMAC
+	pepper     string
 	emailRegex *regexp.Regexp
 }
 
@@ -127,6 +153,9 @@ type User struct {
 	PasswordHash string `gorm:"not null"`
 	Remember     string `gorm:"-"`
 	RememberHash string `gorm:"not null;unique_index"`
+	Admin        bool   `gorm:"not null;default:false"`
+	// Disabled users cannot sign in, and their sessions stop working.
+	Disabled bool `gorm:"not null;default:false"`
 }
 
 // userValFn is the function type for user validation functions
@@ -134,32 +163,73 @@ type userValFn func(*User) error
 
 // runUserValFns accepts a pointer to a user and any number of
 // validation functions that comply to the type userValFn signature,
-// then iterates over all the validation functions.
+// then iterates over all the validation functions. Field validation
+// failures are collected into a ValidationError so that every invalid
+// field is reported; any other error stops validation right away.
 func runUserValFns(user *User, fns ...userValFn) error {
+	var verr ValidationError
 	for _, fn := range fns {
-		if err := fn(user); err != nil {
+		if err := fn(user); err != nil && !verr.add(err) {
+			return err
+		}
+	}
+	return verr.err()
+}
+
+// runUserValStages runs each stage of validation functions with
+// runUserValFns, stopping after the first stage that fails. Cheap
+// format checks go first, so that slow ones such as bcrypt and
+// database lookups are not spent on a user who is rejected anyway.
+func runUserValStages(user *User, stages ...[]userValFn) error {
+	for _, fns := range stages {
+		if err := runUserValFns(user, fns...); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// NewUserService returns a pointer to UserService
-func NewUserService(db *gorm.DB) UserService {
-	ug := &userGorm{db}
+// NewUserService returns a pointer to UserService. pepper is added to
+// every password before hashing, and hmacKey is used to hash remember
+// tokens.
+func NewUserService(db *gorm.DB, pepper, hmacKey string) UserService {
+	return newUserService(NewGormUserDB(db), pepper, hmacKey)
+}
 
-	hmac := hash.NewHMAC(hmacSecretKey)
-	uv := newUserValidator(ug, hmac)
+// NewGormUserDB returns the UserDB that stores users with gorm,
+// without the validation layer
+func NewGormUserDB(db *gorm.DB) UserDB {
+	return &userGorm{db: db, replica: db}
+}
+
+// NewMemoryUserService returns a UserService that keeps users in
+// memory instead of a database, with the same validation as
+// NewUserService.
+func NewMemoryUserService(pepper, hmacKey string) UserService {
+	return newUserService(NewMemoryUserDB(), pepper, hmacKey)
+}
+
+func newUserService(udb UserDB, pepper, hmacKey string) UserService {
+	hmac := hash.NewHMAC(hmacKey)
+	uv := newUserValidator(udb, hmac, pepper)
+
+	var primary UserDB = uv
+	if pr, ok := udb.(primaryReader); ok {
+		primary = newUserValidator(pr.primary(), hmac, pepper)
+	}
 
 	return &userService{
-		UserDB: uv,
+		UserDB:  uv,
+		primary: primary,
+		pepper:  pepper,
 	}
 }
 
-func newUserValidator(udb UserDB, hmac hash.HMAC) *userValidator {
+func newUserValidator(udb UserDB, hmac hash.HMAC, pepper string) *userValidator {
 	return &userValidator{
 		UserDB: udb,
 		hmac:   hmac,
+		pepper: pepper,
 		emailRegex: regexp.MustCompile(
 			`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,16}$`,
 		),
@@ -175,7 +245,7 @@ func (uv *userValidator) bcryptPassword(user *User) error {
 		return nil
 	}
 
-	pwBytes := []byte(user.Password + userPasswordPepper)
+	pwBytes := []byte(user.Password + uv.pepper)
 	hashedBytes, err := bcrypt.GenerateFromPassword(pwBytes, bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -197,7 +267,7 @@ func (uv *userValidator) passwordRequired(user *User) error {
 }
 
 // passwordHashRequired validates if a password hash is present in
-// userValidator.Create and userValidator.Update.
+// userValidator.Create.
 // This method comes after the password is generated by userValidator.bcryptPassword.
 func (uv *userValidator) passwordHashRequired(user *User) error {
 	if user.PasswordHash == "" {
@@ -363,20 +433,21 @@ func (uv *userValidator) ByRemember(token string) (*User, error) {
 // Create creates the provided user and backfills data
 // such as ID, CreateAt, and UpdateAt fields.
 func (uv *userValidator) Create(user *User) error {
-	err := runUserValFns(
+	err := runUserValStages(
 		user,
-		uv.passwordRequired,
-		uv.passwordMinLength,
-		uv.bcryptPassword,
-		uv.passwordHashRequired,
-		uv.setRememberIfUnset,
-		uv.rememberMinBytes,
-		uv.hmacRemember,
-		uv.rememberHashRequired,
-		uv.normalizeEmail,
-		uv.requireEmail, // Use after normalizeEmail in case email is whitespace " "
-		uv.emailFormat,
-		uv.emailIsAvail,
+		[]userValFn{
+			uv.passwordRequired,
+			uv.passwordMinLength,
+			uv.setRememberIfUnset,
+			uv.rememberMinBytes,
+			uv.hmacRemember,
+			uv.rememberHashRequired,
+			uv.normalizeEmail,
+			uv.requireEmail, // Use after normalizeEmail in case email is whitespace " "
+			uv.emailFormat,
+		},
+		[]userValFn{uv.emailIsAvail},
+		[]userValFn{uv.bcryptPassword, uv.passwordHashRequired},
 	)
 	if err != nil {
 		return err
@@ -385,20 +456,24 @@ func (uv *userValidator) Create(user *User) error {
 	return uv.UserDB.Create(user)
 }
 
-// Update hashes a remember token if one is provided
+// Update hashes a remember token if one is provided. Users without a
+// Password or PasswordHash keep their current password, which is how
+// users served from the user cache, which never holds password
+// hashes, are updated.
 func (uv *userValidator) Update(user *User) error {
-	err := runUserValFns(
+	err := runUserValStages(
 		user,
-		uv.passwordMinLength,
-		uv.bcryptPassword,
-		uv.passwordHashRequired,
-		uv.rememberMinBytes,
-		uv.hmacRemember,
-		uv.rememberHashRequired,
-		uv.normalizeEmail,
-		uv.requireEmail,
-		uv.emailFormat,
-		uv.emailIsAvail,
+		[]userValFn{
+			uv.passwordMinLength,
+			uv.rememberMinBytes,
+			uv.hmacRemember,
+			uv.rememberHashRequired,
+			uv.normalizeEmail,
+			uv.requireEmail,
+			uv.emailFormat,
+		},
+		[]userValFn{uv.emailIsAvail},
+		[]userValFn{uv.bcryptPassword},
 	)
 	if err != nil {
 		return err
@@ -428,7 +503,11 @@ func (ug *userGorm) Create(user *User) error {
 
 // Update updates the provided user with the data provided.
 func (ug *userGorm) Update(user *User) error {
-	return ug.db.Save(user).Error
+	db := ug.db
+	if user.PasswordHash == "" {
+		db = db.Omit("password_hash")
+	}
+	return db.Save(user).Error
 }
 
 // Delete deletes the user with the provided ID
@@ -448,8 +527,7 @@ func (ug *userGorm) Delete(id uint) error {
 // in a 500 error.
 func (ug *userGorm) ByID(id uint) (*User, error) {
 	var user User
-	db := ug.db.Where("id = ?", id)
-	err := first(db, &user)
+	err := firstOnReplica(ug.db, ug.replica, &user, "id = ?", id)
 	if err != nil {
 		return nil, err
 	}
@@ -464,14 +542,17 @@ func (ug *userGorm) ByID(id uint) (*User, error) {
 // more information on what went wrong.
 func (ug *userGorm) ByEmail(email string) (*User, error) {
 	var user User
-	db := ug.db.Where("email = ?", email)
-	err := first(db, &user)
+	err := firstOnReplica(ug.db, ug.replica, &user, "email = ?", email)
 	return &user, err
 }
 
 // ByRemember looks up a user with a given remember token
 // and returns the user from the database. This method handles
 // token hashing.
+//
+// It always reads the primary: a replica that lags behind would keep
+// accepting a token rotated at logout, or the session of a user who
+// was just disabled.
 func (ug *userGorm) ByRemember(rememberHash string) (*User, error) {
 	var user User
 	err := first(ug.db.Where("remember_hash = ?", rememberHash), &user) // Gorm uses snake case
@@ -482,6 +563,16 @@ func (ug *userGorm) ByRemember(rememberHash string) (*User, error) {
 	return &user, nil
 }
 
+// All returns every user ordered by ID
+func (ug *userGorm) All() ([]User, error) {
+	var users []User
+	err := ug.replica.Order("id").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 // first will query using the provided gorm.DB and it returns
 // the first item returned and place it into dst. If nothing
 // is found in the query, the method returns ErrNotFound
@@ -493,24 +584,57 @@ func first(db *gorm.DB, dst interface{}) error {
 	return err
 }
 
+// primary implements primaryReader
+func (ug *userGorm) primary() UserDB {
+	return &userGorm{db: ug.db, replica: ug.db}
+}
+
+// firstOnReplica is first for a lookup on the replica. A record that
+// is not there yet may only just have been written to the primary, so
+// the primary is asked before returning ErrNotFound.
+func firstOnReplica(primary, replica *gorm.DB, dst interface{}, query string, args ...interface{}) error {
+	err := first(replica.Where(query, args...), dst)
+	if err == ErrNotFound && replica != primary {
+		err = first(primary.Where(query, args...), dst)
+	}
+	return err
+}
+
+// WithContext returns us with tracing under ctx
+func (us *userService) WithContext(ctx context.Context) UserService {
+	return &tracedUserService{UserService: us, ctx: ctx}
+}
+
+// ByIDPrimary looks up the user on the primary database
+func (us *userService) ByIDPrimary(id uint) (*User, error) {
+	return us.primary.ByID(id)
+}
+
 // Authenticate authenticates a user with the provided email and password.
 // If the email address provided is invalid, return nil, ErrNotFound
 // If the password provided is invalid, return nil, ErrPasswordIncorrect
+// If the email and the password are both valid but the user is
+// disabled, return nil, ErrUserDisabled
 // If the email and the password are both valid, return user, nil
 // Otherwise, return nil, error
 func (us *userService) Authenticate(email, password string) (*User, error) {
-	foundUser, err := us.ByEmail(email)
+	// A replica could still have an old password or miss that the
+	// user was disabled
+	foundUser, err := us.primary.ByEmail(email)
 	if err != nil {
 		return nil, err
 	}
 
 	err = bcrypt.CompareHashAndPassword(
 		[]byte(foundUser.PasswordHash),
-		[]byte(password+userPasswordPepper),
+		[]byte(password+us.pepper),
 	)
 
 	switch err {
 	case nil:
+		if foundUser.Disabled {
+			return nil, ErrUserDisabled
+		}
 		return foundUser, nil
 	case bcrypt.ErrMismatchedHashAndPassword:
 		return nil, ErrPasswordIncorrect
@@ -0,0 +1,96 @@
+package models
+
+import "strings"
+
+// errorFields maps the validation errors that concern a single field
+// to the field's name, as used in forms
+var errorFields = map[error]string{
+	ErrEmailRequired:    "email",
+	ErrEmailInvalid:     "email",
+	ErrEmailTaken:       "email",
+	ErrPasswordRequired: "password",
+	ErrPasswordTooShort: "password",
+	ErrTitleRequired:    "title",
+}
+
+// FieldError is a validation failure of a single field
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+// ValidationError is returned by Create and Update when fields fail
+// validation. It holds the first failure of every invalid field, in
+// the order the fields were checked, rather than stopping at the
+// first one. errors.Is reports whether any of the failures is the
+// target, e.g. errors.Is(err, ErrEmailTaken).
+type ValidationError []FieldError
+
+// Error implements error
+func (ve ValidationError) Error() string {
+	msgs := make([]string, len(ve))
+	for i, fe := range ve {
+		msgs[i] = fe.Err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Public implements views.PublicError
+func (ve ValidationError) Public() string {
+	msgs := make([]string, len(ve))
+	for i, fe := range ve {
+		msgs[i] = publicMessage(fe.Err)
+	}
+	return strings.Join(msgs, ". ")
+}
+
+// FieldErrors returns the public message for every invalid field,
+// keyed by field name. It implements views.FieldErrors.
+func (ve ValidationError) FieldErrors() map[string]string {
+	fields := make(map[string]string, len(ve))
+	for _, fe := range ve {
+		fields[fe.Field] = publicMessage(fe.Err)
+	}
+	return fields
+}
+
+// Is reports whether target is the error of any field
+func (ve ValidationError) Is(target error) bool {
+	for _, fe := range ve {
+		if fe.Err == target {
+			return true
+		}
+	}
+	return false
+}
+
+// add records err if it is a field validation error, unless its field
+// already failed, and reports whether it was one
+func (ve *ValidationError) add(err error) bool {
+	field, ok := errorFields[err]
+	if !ok {
+		return false
+	}
+	for _, fe := range *ve {
+		if fe.Field == field {
+			return true
+		}
+	}
+	*ve = append(*ve, FieldError{Field: field, Err: err})
+	return true
+}
+
+// err returns ve as an error, or nil if no field failed
+func (ve ValidationError) err() error {
+	if len(ve) == 0 {
+		return nil
+	}
+	return ve
+}
+
+func publicMessage(err error) string {
+	if pe, ok := err.(interface{ Public() string }); ok {
+		return pe.Public()
+	}
+	return err.Error()
+}
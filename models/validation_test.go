@@ -0,0 +1,186 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nahuakang/gophotos/hash"
+)
+
+func TestValidationError(t *testing.T) {
+	tests := []struct {
+		name       string
+		errs       []error
+		wantFields map[string]string
+		wantPublic string
+	}{
+		{
+			name:       "one field",
+			errs:       []error{ErrEmailInvalid},
+			wantFields: map[string]string{"email": "Email address is not valid"},
+			wantPublic: "Email address is not valid",
+		},
+		{
+			name: "every field",
+			errs: []error{ErrPasswordTooShort, ErrEmailTaken, ErrTitleRequired},
+			wantFields: map[string]string{
+				"password": "Password should be at least 8 characters long",
+				"email":    "Email address is already taken",
+				"title":    "Title is required",
+			},
+			wantPublic: "Password should be at least 8 characters long. " +
+				"Email address is already taken. Title is required",
+		},
+		{
+			name:       "first failure of a field wins",
+			errs:       []error{ErrEmailRequired, ErrEmailInvalid, ErrEmailTaken},
+			wantFields: map[string]string{"email": "Email address is required"},
+			wantPublic: "Email address is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ve ValidationError
+			for _, err := range tt.errs {
+				if !ve.add(err) {
+					t.Fatalf("add(%v) = false, want true for a field error", err)
+				}
+			}
+			err := ve.err()
+
+			var got ValidationError
+			if !errors.As(err, &got) {
+				t.Fatalf("err = %T, want a ValidationError", err)
+			}
+			if len(got) != len(tt.wantFields) {
+				t.Errorf("ValidationError has %d entries, want one per field: %v", len(got), got)
+			}
+			if fields := got.FieldErrors(); !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("FieldErrors() = %v, want %v", fields, tt.wantFields)
+			}
+			if public := got.Public(); public != tt.wantPublic {
+				t.Errorf("Public() = %q, want %q", public, tt.wantPublic)
+			}
+			for _, fe := range got {
+				if !errors.Is(err, fe.Err) {
+					t.Errorf("errors.Is(err, %v) = false, want true", fe.Err)
+				}
+			}
+			if errors.Is(err, ErrPasswordRequired) {
+				t.Errorf("errors.Is(err, ErrPasswordRequired) = true, want false")
+			}
+		})
+	}
+
+	var ve ValidationError
+	if ve.add(ErrNotFound) {
+		t.Errorf("add(ErrNotFound) = true, want false for an error of no field")
+	}
+	if err := ve.err(); err != nil {
+		t.Errorf("err() without failures = %v, want nil", err)
+	}
+}
+
+// emailLookupDB counts the email lookups done by emailIsAvail
+type emailLookupDB struct {
+	UserDB
+	lookups int
+}
+
+func (e *emailLookupDB) ByEmail(email string) (*User, error) {
+	e.lookups++
+	return e.UserDB.ByEmail(email)
+}
+
+func TestUserValidatorReportsEveryField(t *testing.T) {
+	const taken = "michael@dundermifflin.com"
+	tests := []struct {
+		name        string
+		user        User
+		wantFields  map[string]string
+		wantLookups int
+	}{
+		{
+			name: "invalid email and short password",
+			user: User{Email: "michael", Password: "short"},
+			wantFields: map[string]string{
+				"email":    "Email address is not valid",
+				"password": "Password should be at least 8 characters long",
+			},
+		},
+		{
+			name: "missing email and password",
+			user: User{},
+			wantFields: map[string]string{
+				"email":    "Email address is required",
+				"password": "Password is required",
+			},
+		},
+		{
+			name:       "invalid email",
+			user:       User{Email: "michael@", Password: "worldsbestboss"},
+			wantFields: map[string]string{"email": "Email address is not valid"},
+		},
+		{
+			name:       "taken email with a short password",
+			user:       User{Email: taken, Password: "short"},
+			wantFields: map[string]string{"password": "Password should be at least 8 characters long"},
+		},
+		{
+			name:        "taken email",
+			user:        User{Email: "  Michael@DunderMifflin.com ", Password: "worldsbestboss"},
+			wantFields:  map[string]string{"email": "Email address is already taken"},
+			wantLookups: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &emailLookupDB{UserDB: NewMemoryUserDB()}
+			uv := newUserValidator(db, hash.NewHMAC("hmac-key"), "pepper")
+			existing := User{Email: taken, PasswordHash: "hash", RememberHash: "remember"}
+			if err := db.Create(&existing); err != nil {
+				t.Fatal(err)
+			}
+
+			user := tt.user
+			err := uv.Create(&user)
+			var ve ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("Create() err = %v, want a ValidationError", err)
+			}
+			if got := ve.FieldErrors(); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("FieldErrors() = %v, want %v", got, tt.wantFields)
+			}
+			if db.lookups != tt.wantLookups {
+				t.Errorf("email lookups = %d, want %d", db.lookups, tt.wantLookups)
+			}
+			// bcrypt only runs for users that can be saved
+			if user.PasswordHash != "" {
+				t.Errorf("the password was hashed for a user that failed validation")
+			}
+		})
+	}
+}
+
+func TestUserValidatorUpdateSkipsSlowChecks(t *testing.T) {
+	db := &emailLookupDB{UserDB: NewMemoryUserDB()}
+	uv := newUserValidator(db, hash.NewHMAC("hmac-key"), "pepper")
+	user := User{Email: "jim@dundermifflin.com", Password: "bigtuna123"}
+	if err := uv.Create(&user); err != nil {
+		t.Fatalf("Create() err = %v, want nil", err)
+	}
+	db.lookups = 0
+
+	user.Email = "jim at dunder mifflin"
+	user.Password = "newpassword"
+	user.PasswordHash = ""
+	err := uv.Update(&user)
+	if !errors.Is(err, ErrEmailInvalid) {
+		t.Fatalf("Update() err = %v, want %v", err, ErrEmailInvalid)
+	}
+	if db.lookups != 0 || user.PasswordHash != "" {
+		t.Errorf("Update() looked up the email %d times and hashed the password = %v, want neither",
+			db.lookups, user.PasswordHash != "")
+	}
+}
@@ -0,0 +1,64 @@
+// Package policy decides what a user is allowed to do with galleries
+// and user accounts. Every handler (and any future API) should ask
+// this package instead of comparing IDs itself, so the rules live in
+// one place.
+//
+// The subject of every decision is the signed in user, or nil for an
+// anonymous visitor. Admins may do anything an owner may.
+package policy
+
+import "github.com/nahuakang/gophotos/models"
+
+// CanView reports whether user may view gallery. Galleries are
+// public, so anyone, including anonymous visitors, can view them.
+func CanView(user *models.User, gallery *models.Gallery) bool {
+	return gallery != nil
+}
+
+// CanCreate reports whether user may create galleries
+func CanCreate(user *models.User) bool {
+	return user != nil
+}
+
+// CanEdit reports whether user may change gallery's details
+func CanEdit(user *models.User, gallery *models.Gallery) bool {
+	return manageGallery(user, gallery)
+}
+
+// CanDelete reports whether user may delete gallery
+func CanDelete(user *models.User, gallery *models.Gallery) bool {
+	return manageGallery(user, gallery)
+}
+
+// CanUpload reports whether user may add images to gallery
+func CanUpload(user *models.User, gallery *models.Gallery) bool {
+	return manageGallery(user, gallery)
+}
+
+// CanEditUser reports whether user may change target's account
+func CanEditUser(user, target *models.User) bool {
+	if user == nil || target == nil {
+		return false
+	}
+	return user.ID == target.ID || IsAdmin(user)
+}
+
+// IsAdmin reports whether user is an administrator
+func IsAdmin(user *models.User) bool {
+	return user != nil && user.Admin
+}
+
+// manageGallery reports whether user owns gallery or is an admin
+func manageGallery(user *models.User, gallery *models.Gallery) bool {
+	if gallery == nil {
+		return false
+	}
+	return ownsGallery(user, gallery) || IsAdmin(user)
+}
+
+func ownsGallery(user *models.User, gallery *models.Gallery) bool {
+	if user == nil || gallery == nil {
+		return false
+	}
+	return user.ID != 0 && gallery.UserID == user.ID
+}
@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/nahuakang/gophotos/models"
+)
+
+var (
+	owner   = &models.User{Model: gorm.Model{ID: 1}}
+	other   = &models.User{Model: gorm.Model{ID: 2}}
+	admin   = &models.User{Model: gorm.Model{ID: 3}, Admin: true}
+	gallery = &models.Gallery{Model: gorm.Model{ID: 10}, UserID: owner.ID}
+)
+
+func TestGalleryPolicy(t *testing.T) {
+	decisions := []struct {
+		name string
+		fn   func(*models.User, *models.Gallery) bool
+	}{
+		{"CanEdit", CanEdit},
+		{"CanDelete", CanDelete},
+		{"CanUpload", CanUpload},
+	}
+	tests := []struct {
+		name    string
+		user    *models.User
+		gallery *models.Gallery
+		want    bool
+	}{
+		{"anonymous", nil, gallery, false},
+		{"owner", owner, gallery, true},
+		{"other user", other, gallery, false},
+		{"admin", admin, gallery, true},
+		{"owner without a gallery", owner, nil, false},
+		{"admin without a gallery", admin, nil, false},
+		{"unsaved user", &models.User{}, &models.Gallery{}, false},
+	}
+	for _, d := range decisions {
+		for _, tt := range tests {
+			t.Run(d.name+"/"+tt.name, func(t *testing.T) {
+				if got := d.fn(tt.user, tt.gallery); got != tt.want {
+					t.Errorf("%s() = %v, want %v", d.name, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestCanView(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *models.User
+		gallery *models.Gallery
+		want    bool
+	}{
+		{"anonymous", nil, gallery, true},
+		{"owner", owner, gallery, true},
+		{"other user", other, gallery, true},
+		{"admin", admin, gallery, true},
+		{"no gallery", owner, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanView(tt.user, tt.gallery); got != tt.want {
+				t.Errorf("CanView() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanCreate(t *testing.T) {
+	tests := []struct {
+		name string
+		user *models.User
+		want bool
+	}{
+		{"anonymous", nil, false},
+		{"user", other, true},
+		{"admin", admin, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanCreate(tt.user); got != tt.want {
+				t.Errorf("CanCreate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanEditUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   *models.User
+		target *models.User
+		want   bool
+	}{
+		{"anonymous", nil, owner, false},
+		{"themselves", owner, owner, true},
+		{"other user", other, owner, false},
+		{"admin", admin, owner, true},
+		{"admin without a target", admin, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanEditUser(tt.user, tt.target); got != tt.want {
+				t.Errorf("CanEditUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	tests := []struct {
+		name string
+		user *models.User
+		want bool
+	}{
+		{"anonymous", nil, false},
+		{"user", owner, false},
+		{"admin", admin, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsAdmin(tt.user); got != tt.want {
+				t.Errorf("IsAdmin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
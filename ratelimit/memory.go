@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore drops buckets that have
+// refilled completely and so hold no state worth keeping.
+const sweepInterval = 5 * time.Minute
+
+// NewMemoryStore returns a Store that keeps buckets in process memory
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// MemoryStore is a Store for a single instance of the app. It is safe
+// for concurrent use.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// Ensure MemoryStore implements Store interface
+var _ Store = &MemoryStore{}
+
+// Take implements Store
+func (ms *MemoryStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if now.Sub(ms.lastSweep) > sweepInterval {
+		ms.sweep(now)
+	}
+
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		ms.buckets[key] = b
+	}
+	b.tokens = Refill(b.tokens, b.last, now, limit)
+	b.last = now
+	b.limit = limit
+
+	if b.tokens < 1 {
+		return false, RetryAfter(b.tokens, limit), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// sweep removes full buckets. The caller must hold ms.mu.
+func (ms *MemoryStore) sweep(now time.Time) {
+	for key, b := range ms.buckets {
+		if Refill(b.tokens, b.last, now, b.limit) >= float64(b.limit.Burst) {
+			delete(ms.buckets, key)
+		}
+	}
+	ms.lastSweep = now
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func mustTake(t *testing.T, ms *MemoryStore, key string, limit Limit, now time.Time) (bool, time.Duration) {
+	t.Helper()
+	ok, retryAfter, err := ms.Take(key, limit, now)
+	if err != nil {
+		t.Fatalf("Take(%q) err = %v, want nil", key, err)
+	}
+	return ok, retryAfter
+}
+
+func TestMemoryStoreBurst(t *testing.T) {
+	ms := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := 0; i < limit.Burst; i++ {
+		if ok, _ := mustTake(t, ms, "a", limit, start); !ok {
+			t.Fatalf("Take() #%d within the burst was refused", i+1)
+		}
+	}
+	ok, retryAfter := mustTake(t, ms, "a", limit, start)
+	if ok {
+		t.Fatalf("Take() over the burst was allowed")
+	}
+	if retryAfter != time.Second {
+		t.Errorf("retryAfter = %v, want %v", retryAfter, time.Second)
+	}
+
+	if ok, _ := mustTake(t, ms, "b", limit, start); !ok {
+		t.Errorf("Take() for another key was refused")
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	ms := NewMemoryStore()
+	limit := Limit{Rate: 2, Burst: 1}
+	mustTake(t, ms, "a", limit, start)
+
+	ok, retryAfter := mustTake(t, ms, "a", limit, start.Add(250*time.Millisecond))
+	if ok {
+		t.Fatalf("Take() before a token refilled was allowed")
+	}
+	if retryAfter != 250*time.Millisecond {
+		t.Errorf("retryAfter = %v, want %v", retryAfter, 250*time.Millisecond)
+	}
+
+	if ok, _ := mustTake(t, ms, "a", limit, start.Add(500*time.Millisecond)); !ok {
+		t.Errorf("Take() once a token refilled was refused")
+	}
+	// Refilling stops at the burst however long the bucket sits idle
+	later := start.Add(time.Hour)
+	if ok, _ := mustTake(t, ms, "a", limit, later); !ok {
+		t.Errorf("Take() after an hour was refused")
+	}
+	if ok, _ := mustTake(t, ms, "a", limit, later); ok {
+		t.Errorf("Take() beyond the burst after an hour was allowed")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ms := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 2}
+	slow := Limit{Rate: 1.0 / 3600, Burst: 2}
+	mustTake(t, ms, "full", limit, start)
+	mustTake(t, ms, "refilling", slow, start)
+
+	// The first Take sweeps, the next ones don't until the interval
+	// has passed
+	mustTake(t, ms, "other", limit, start.Add(sweepInterval))
+	if n := len(ms.buckets); n != 3 {
+		t.Fatalf("%d buckets before the sweep interval, want 3", n)
+	}
+
+	mustTake(t, ms, "other", limit, start.Add(2*sweepInterval+time.Second))
+	if _, ok := ms.buckets["full"]; ok {
+		t.Errorf("the refilled bucket was kept by the sweep")
+	}
+	if _, ok := ms.buckets["refilling"]; !ok {
+		t.Errorf("a bucket still refilling was swept")
+	}
+	if _, ok := ms.buckets["other"]; !ok {
+		t.Errorf("the bucket just used was swept")
+	}
+}
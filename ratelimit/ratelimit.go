@@ -0,0 +1,64 @@
+// Package ratelimit implements token bucket rate limiting. Each key
+// (an IP address, user ID, route name...) gets a bucket holding up to
+// Limit.Burst tokens which refills at Limit.Rate tokens per second.
+// Every request takes one token and is rejected when none are left.
+//
+// Buckets are kept in a Store, so the same limits can be enforced by
+// a single process (MemoryStore) or shared between instances through
+// the database (see models.WithRateLimit).
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limit describes the size and refill rate of a token bucket
+type Limit struct {
+	// Rate is the number of tokens added per second
+	Rate float64
+	// Burst is the maximum number of tokens in the bucket
+	Burst int
+}
+
+// PerMinute returns a Limit allowing n requests per minute on
+// average, with bursts of up to burst requests.
+func PerMinute(n, burst int) Limit {
+	return Limit{
+		Rate:  float64(n) / 60,
+		Burst: burst,
+	}
+}
+
+// Store keeps token buckets
+type Store interface {
+	// Take removes a token from the bucket for key, creating a full
+	// bucket if there is none. If the bucket is empty, ok is false and
+	// retryAfter is how long until a token will be available.
+	Take(key string, limit Limit, now time.Time) (ok bool, retryAfter time.Duration, err error)
+}
+
+// Refill returns the number of tokens in a bucket that had tokens
+// left at last, after refilling it for the time elapsed until now.
+// It is exported for Store implementations.
+func Refill(tokens float64, last, now time.Time, limit Limit) float64 {
+	elapsed := now.Sub(last).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+}
+
+// RetryAfter returns how long a bucket holding tokens has to wait
+// until it holds a whole token again. It is exported for Store
+// implementations.
+func RetryAfter(tokens float64, limit Limit) time.Duration {
+	if tokens >= 1 {
+		return 0
+	}
+	if limit.Rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	seconds := (1 - tokens) / limit.Rate
+	return time.Duration(seconds * float64(time.Second))
+}
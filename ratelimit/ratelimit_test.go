@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestPerMinute(t *testing.T) {
+	limit := PerMinute(30, 5)
+	if limit.Rate != 0.5 || limit.Burst != 5 {
+		t.Errorf("PerMinute(30, 5) = %+v, want Rate 0.5 and Burst 5", limit)
+	}
+}
+
+func TestRefill(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 5}
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time passed", 1, 0, 1},
+		{"partial token", 0, 250 * time.Millisecond, 0.5},
+		{"whole tokens", 1, 1500 * time.Millisecond, 4},
+		{"capped at burst", 1, time.Hour, 5},
+		{"clock went backwards", 3, -time.Second, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Refill(tt.tokens, start, start.Add(tt.elapsed), limit)
+			if got != tt.want {
+				t.Errorf("Refill(%v, %v) = %v, want %v", tt.tokens, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens float64
+		limit  Limit
+		want   time.Duration
+	}{
+		{"token available", 1, Limit{Rate: 1, Burst: 1}, 0},
+		{"empty bucket", 0, Limit{Rate: 1, Burst: 1}, time.Second},
+		{"partly refilled", 0.75, Limit{Rate: 1, Burst: 1}, 250 * time.Millisecond},
+		{"slow rate", 0, PerMinute(1, 1), time.Minute},
+		{"never refills", 0, Limit{Rate: 0, Burst: 1}, time.Duration(math.MaxInt64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RetryAfter(tt.tokens, tt.limit)
+			if got != tt.want {
+				t.Errorf("RetryAfter(%v, %+v) = %v, want %v", tt.tokens, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// NewOTLPJSONExporter returns an Exporter that writes every span to w
+// as one line of OTLP/JSON (an ExportTraceServiceRequest), the format
+// of the OpenTelemetry Collector's file exporter and otlpjsonfile
+// receiver. Point w at stderr to watch spans while developing, or at a
+// file to load them into a tracing backend later.
+func NewOTLPJSONExporter(w io.Writer, serviceName string) Exporter {
+	return &otlpJSONExporter{
+		w:       w,
+		service: serviceName,
+	}
+}
+
+type otlpJSONExporter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	service string
+}
+
+// Export implements Exporter. Write errors are dropped; tracing must
+// never fail a request.
+func (e *otlpJSONExporter) Export(span SpanData) {
+	req := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttr{attr("service.name", e.service)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/nahuakang/gophotos/trace"},
+				Spans: []otlpSpan{toOTLP(span)},
+			}},
+		}},
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(b)
+}
+
+func toOTLP(span SpanData) otlpSpan {
+	s := otlpSpan{
+		TraceID:           span.TraceID.String(),
+		SpanID:            span.SpanID.String(),
+		Name:              span.Name,
+		Kind:              span.Kind,
+		StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+	}
+	if span.Parent != (SpanID{}) {
+		s.ParentSpanID = span.Parent.String()
+	}
+	for _, a := range span.Attrs {
+		s.Attributes = append(s.Attributes, attr(a.Key, a.Value))
+	}
+	if span.Error != "" {
+		s.Status = &otlpStatus{Code: 2, Message: span.Error}
+	}
+	return s
+}
+
+// attr converts a value to an OTLP attribute. 64 bit integers are
+// strings in OTLP/JSON.
+func attr(key string, value interface{}) otlpAttr {
+	var v otlpValue
+	switch x := value.(type) {
+	case string:
+		v.StringValue = &x
+	case bool:
+		v.BoolValue = &x
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprint(x)
+		v.IntValue = &s
+	case float32:
+		f := float64(x)
+		v.DoubleValue = &f
+	case float64:
+		v.DoubleValue = &x
+	case error:
+		s := x.Error()
+		v.StringValue = &s
+	default:
+		s := fmt.Sprint(x)
+		v.StringValue = &s
+	}
+	return otlpAttr{Key: key, Value: v}
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr  `json:"attributes,omitempty"`
+	Status            *otlpStatus `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
@@ -0,0 +1,347 @@
+// Package trace records spans of work done for a request and exports
+// them, in the spirit of OpenTelemetry but without its dependencies.
+//
+// The HTTP middleware starts a span for every request, continuing the
+// trace of an incoming W3C traceparent header, and stores it in the
+// request context. Code further down starts child spans from that
+// context:
+//
+//	ctx, span := trace.Start(r.Context(), "View.Render", "template", name)
+//	defer span.End()
+//
+// Start returns a nil *Span when the context carries no span, and
+// every Span method is a no-op on nil, so callers never have to check
+// whether tracing is enabled.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the ID as lowercase hex
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// String returns the ID as lowercase hex
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span that is propagated to other
+// services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// traceparentHeader is the W3C Trace Context header
+const traceparentHeader = "traceparent"
+
+// Traceparent formats sc as a version 00 traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Extract reads the span context from the traceparent header of h
+func Extract(h http.Header) (SpanContext, bool) {
+	return ParseTraceparent(h.Get(traceparentHeader))
+}
+
+// Inject sets the traceparent header of h to sc, for outgoing requests
+func Inject(h http.Header, sc SpanContext) {
+	if sc.IsValid() {
+		h.Set(traceparentHeader, sc.Traceparent())
+	}
+}
+
+// ParseTraceparent parses a traceparent header value. Versions other
+// than 00 are accepted as long as they start with the 00 fields, as
+// the specification asks.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 {
+		return sc, false
+	}
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// decodeHex decodes lowercase hex s into dst, which it must fill exactly
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Span kinds, numbered as in OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+)
+
+// Span is a timed operation within a trace
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	kind   int
+
+	mu    sync.Mutex
+	name  string
+	start time.Time
+	end   time.Time
+	attrs []Attr
+	err   string
+	ended bool
+}
+
+// Attr is a span attribute
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// Context returns the span's propagation context. It is the zero
+// SpanContext for a nil span.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetName renames the span, e.g. once the matched route is known
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttributes adds attributes to the span. keyvals alternate between
+// string keys and values, like the logger's.
+func (s *Span) SetAttributes(keyvals ...interface{}) {
+	if s == nil {
+		return
+	}
+	attrs := toAttrs(keyvals)
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed with err. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and hands it to the exporter if it is
+// sampled. Calls after the first are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	data := SpanData{
+		SpanContext: s.sc,
+		Parent:      s.parent,
+		Kind:        s.kind,
+		Name:        s.name,
+		Start:       s.start,
+		End:         s.end,
+		Attrs:       s.attrs,
+		Error:       s.err,
+	}
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// SpanData is a finished span as handed to an Exporter
+type SpanData struct {
+	SpanContext
+	Parent SpanID // zero for root spans
+	Kind   int
+	Name   string
+	Start  time.Time
+	End    time.Time
+	Attrs  []Attr
+	// Error is the message of the error recorded on the span, if any
+	Error string
+}
+
+// Exporter sends finished spans somewhere. Export is called from
+// the goroutine that ends the span and must be safe for concurrent use.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer starts root spans and exports every sampled span
+type Tracer struct {
+	exporter Exporter
+	// sampleRatio is the share of new traces that are recorded
+	sampleRatio float64
+}
+
+// New returns a Tracer that records sampleRatio (0 to 1) of the traces
+// it starts and sends their spans to exporter. Traces continued from
+// an incoming traceparent follow the caller's sampling decision.
+func New(exporter Exporter, sampleRatio float64) *Tracer {
+	return &Tracer{
+		exporter:    exporter,
+		sampleRatio: sampleRatio,
+	}
+}
+
+// StartServer starts the span of an incoming request. If remote is
+// valid the span continues that trace, otherwise it starts a new one.
+func (t *Tracer) StartServer(ctx context.Context, name string, remote SpanContext) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		kind:   KindServer,
+		name:   name,
+		start:  time.Now(),
+	}
+	if remote.IsValid() {
+		span.sc.TraceID = remote.TraceID
+		span.sc.Sampled = remote.Sampled
+		span.parent = remote.SpanID
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = t.sample()
+	}
+	span.sc.SpanID = newSpanID()
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+// sample decides whether a new trace is recorded
+func (t *Tracer) sample() bool {
+	switch {
+	case t.sampleRatio >= 1:
+		return true
+	case t.sampleRatio <= 0:
+		return false
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return float64(binary.BigEndian.Uint64(b[:])>>11)/(1<<53) < t.sampleRatio
+}
+
+type contextKey string
+
+const spanKey contextKey = "span"
+
+// FromContext returns the current span of ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey).(*Span)
+	return span
+}
+
+// Start starts a child of the current span of ctx, with the given
+// attributes, and returns a context carrying the child. Without a
+// current span it returns ctx and a nil span.
+func Start(ctx context.Context, name string, keyvals ...interface{}) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer: parent.tracer,
+		sc: SpanContext{
+			TraceID: parent.sc.TraceID,
+			SpanID:  newSpanID(),
+			Sampled: parent.sc.Sampled,
+		},
+		parent: parent.sc.SpanID,
+		kind:   KindInternal,
+		name:   name,
+		start:  time.Now(),
+		attrs:  toAttrs(keyvals),
+	}
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func toAttrs(keyvals []interface{}) []Attr {
+	attrs := make([]Attr, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		var value interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		attrs = append(attrs, Attr{Key: key, Value: value})
+	}
+	return attrs
+}
@@ -0,0 +1,145 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+const (
+	validTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	validSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-" + validTraceID + "-" + validSpanID + "-01", true, true},
+		{"not sampled", "00-" + validTraceID + "-" + validSpanID + "-00", true, false},
+		{"other flags", "00-" + validTraceID + "-" + validSpanID + "-03", true, true},
+		{"surrounding whitespace", " 00-" + validTraceID + "-" + validSpanID + "-01 ", true, true},
+		{"uppercase trace ID", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + validSpanID + "-01", false, false},
+		{"uppercase span ID", "00-" + validTraceID + "-00F067AA0BA902B7-01", false, false},
+		{"all-zero trace ID", "00-00000000000000000000000000000000-" + validSpanID + "-01", false, false},
+		{"all-zero span ID", "00-" + validTraceID + "-0000000000000000-01", false, false},
+		{"version ff", "ff-" + validTraceID + "-" + validSpanID + "-01", false, false},
+		{"future version", "01-" + validTraceID + "-" + validSpanID + "-01", true, true},
+		{"future version with extra fields", "cc-" + validTraceID + "-" + validSpanID + "-01-what-the-future-holds", true, true},
+		{"version 00 with extra fields", "00-" + validTraceID + "-" + validSpanID + "-01-extra", false, false},
+		{"invalid version", "0x-" + validTraceID + "-" + validSpanID + "-01", false, false},
+		{"short trace ID", "00-4bf92f3577b34da6-" + validSpanID + "-01", false, false},
+		{"short span ID", "00-" + validTraceID + "-00f067aa-01", false, false},
+		{"non-hex trace ID", "00-4bf92f3577b34da6a3ce929d0e0e473g-" + validSpanID + "-01", false, false},
+		{"short flags", "00-" + validTraceID + "-" + validSpanID + "-1", false, false},
+		{"missing flags", "00-" + validTraceID + "-" + validSpanID, false, false},
+		{"empty", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.header)
+			if ok != tt.ok {
+				t.Fatalf("ParseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if sc.TraceID.String() != validTraceID || sc.SpanID.String() != validSpanID {
+				t.Errorf("ParseTraceparent(%q) = %s, %s, want %s, %s",
+					tt.header, sc.TraceID, sc.SpanID, validTraceID, validSpanID)
+			}
+			if sc.Sampled != tt.sampled {
+				t.Errorf("ParseTraceparent(%q).Sampled = %v, want %v", tt.header, sc.Sampled, tt.sampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	for _, header := range []string{
+		"00-" + validTraceID + "-" + validSpanID + "-01",
+		"00-" + validTraceID + "-" + validSpanID + "-00",
+	} {
+		sc, ok := ParseTraceparent(header)
+		if !ok {
+			t.Fatalf("ParseTraceparent(%q) failed", header)
+		}
+		if got := sc.Traceparent(); got != header {
+			t.Errorf("Traceparent() = %q, want %q", got, header)
+		}
+
+		h := http.Header{}
+		Inject(h, sc)
+		if got, ok := Extract(h); !ok || got != sc {
+			t.Errorf("Extract(Inject(%q)) = %+v, %v, want %+v, true", header, got, ok, sc)
+		}
+	}
+
+	h := http.Header{}
+	Inject(h, SpanContext{})
+	if got := h.Get("traceparent"); got != "" {
+		t.Errorf("Inject() of an invalid span context set traceparent %q", got)
+	}
+}
+
+// recorder is an Exporter that keeps every span
+type recorder struct {
+	spans []SpanData
+}
+
+func (r *recorder) Export(span SpanData) {
+	r.spans = append(r.spans, span)
+}
+
+func TestSpans(t *testing.T) {
+	rec := &recorder{}
+	tracer := New(rec, 1)
+	remote, _ := ParseTraceparent("00-" + validTraceID + "-" + validSpanID + "-01")
+
+	ctx, server := tracer.StartServer(context.Background(), "GET /", remote)
+	_, child := Start(ctx, "users.ByID", "user_id", 7)
+	child.End()
+	child.End() // ignored
+	server.End()
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(rec.spans))
+	}
+	c, s := rec.spans[0], rec.spans[1]
+	if s.TraceID.String() != validTraceID || s.Parent.String() != validSpanID {
+		t.Errorf("server span trace %s, parent %s, want %s, %s", s.TraceID, s.Parent, validTraceID, validSpanID)
+	}
+	if c.TraceID != s.TraceID || c.Parent != s.SpanID {
+		t.Errorf("child span trace %s, parent %s, want %s, %s", c.TraceID, c.Parent, s.TraceID, s.SpanID)
+	}
+	if c.Name != "users.ByID" || len(c.Attrs) != 1 {
+		t.Errorf("child span = %+v, want users.ByID with one attribute", c)
+	}
+
+	// Without a span in the context there is nothing to record
+	if _, span := Start(context.Background(), "orphan"); span != nil {
+		t.Errorf("Start() without a parent = %v, want nil", span)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	rec := &recorder{}
+	tracer := New(rec, 0)
+
+	_, span := tracer.StartServer(context.Background(), "GET /", SpanContext{})
+	span.End()
+	if len(rec.spans) != 0 {
+		t.Errorf("exported %d spans with a sample ratio of 0, want none", len(rec.spans))
+	}
+
+	// The caller's sampling decision wins over the ratio
+	remote, _ := ParseTraceparent("00-" + validTraceID + "-" + validSpanID + "-01")
+	_, span = tracer.StartServer(context.Background(), "GET /", remote)
+	span.End()
+	if len(rec.spans) != 1 {
+		t.Errorf("exported %d spans of a sampled remote trace, want 1", len(rec.spans))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nahuakang/gophotos/logger"
+	"github.com/nahuakang/gophotos/models"
+	"github.com/nahuakang/gophotos/rand"
+)
+
+const userUsage = `usage: gophotos user <create|list|disable|set-password> [arguments] [flags]
+
+  create -email EMAIL [-name NAME] [-admin]
+               create a user, reading the password from stdin
+  list         list every user
+  disable ID   stop a user from signing in and end their sessions
+  set-password ID
+               replace a user's password, reading it from stdin`
+
+// user runs the user command
+func user(args []string, lg *logger.Logger) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return userCreate(args[1:], lg)
+	case "list":
+		return userList(args[1:], lg)
+	case "disable":
+		return userDisable(args[1:], lg)
+	case "set-password":
+		return userSetPassword(args[1:], lg)
+	default:
+		return errors.New(userUsage)
+	}
+}
+
+func userCreate(args []string, lg *logger.Logger) error {
+	fs := newFlagSet("user create", "user create -email EMAIL [-name NAME] [-admin] [flags]")
+	email := fs.String("email", "", "email address to sign in with (required)")
+	name := fs.String("name", "", "display name")
+	admin := fs.Bool("admin", false, "make the user an administrator")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *email == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	u := models.User{
+		Name:     *name,
+		Email:    *email,
+		Password: password,
+		Admin:    *admin,
+	}
+	if err := services.User.Create(&u); err != nil {
+		return err
+	}
+	cliAudit(services, models.AuditEntry{
+		Action:     models.AuditUserCreate,
+		TargetType: models.AuditTargetUser,
+		TargetID:   u.ID,
+		Note:       u.Email,
+	})
+	fmt.Printf("created user %d <%s>\n", u.ID, u.Email)
+	return nil
+}
+
+func userList(args []string, lg *logger.Logger) error {
+	fs := newFlagSet("user list", "user list [flags]")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	users, err := services.User.All()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEMAIL\tNAME\tADMIN\tDISABLED\tCREATED AT")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%t\t%t\t%s\n",
+			u.ID, u.Email, u.Name, u.Admin, u.Disabled,
+			u.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	}
+	return tw.Flush()
+}
+
+func userDisable(args []string, lg *logger.Logger) error {
+	fs := newFlagSet("user disable", "user disable ID [flags]")
+	cfg, id, err := parseFlagsWithID(fs, args)
+	if err != nil {
+		return err
+	}
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	u, err := services.User.ByIDPrimary(id)
+	if err != nil {
+		return fmt.Errorf("user %d: %v", id, err)
+	}
+	if u.Disabled {
+		fmt.Printf("user %d is already disabled\n", u.ID)
+		return nil
+	}
+
+	// A new remember token signs the user out everywhere
+	token, err := rand.RememberToken()
+	if err != nil {
+		return err
+	}
+	u.Remember = token
+	u.Disabled = true
+	if err := services.User.Update(u); err != nil {
+		return err
+	}
+	entry := models.AuditEntry{
+		Action:     models.AuditUserDisable,
+		TargetType: models.AuditTargetUser,
+		TargetID:   u.ID,
+	}
+	entry.SetChanges(map[string]models.Change{
+		"disabled": {From: false, To: true},
+	})
+	cliAudit(services, entry)
+	fmt.Printf("disabled user %d <%s>\n", u.ID, u.Email)
+	return nil
+}
+
+func userSetPassword(args []string, lg *logger.Logger) error {
+	fs := newFlagSet("user set-password", "user set-password ID [flags]")
+	cfg, id, err := parseFlagsWithID(fs, args)
+	if err != nil {
+		return err
+	}
+	services, err := newServices(cfg, lg)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	u, err := services.User.ByIDPrimary(id)
+	if err != nil {
+		return fmt.Errorf("user %d: %v", id, err)
+	}
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	// Existing sessions end along with the old password
+	token, err := rand.RememberToken()
+	if err != nil {
+		return err
+	}
+	u.Password = password
+	u.Remember = token
+	if err := services.User.Update(u); err != nil {
+		return err
+	}
+	cliAudit(services, models.AuditEntry{
+		Action:     models.AuditUserPassword,
+		TargetType: models.AuditTargetUser,
+		TargetID:   u.ID,
+	})
+	fmt.Printf("changed the password of user %d <%s>\n", u.ID, u.Email)
+	return nil
+}
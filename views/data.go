@@ -1,6 +1,10 @@
 package views
 
-import "log"
+import (
+	"html/template"
+
+	"github.com/nahuakang/gophotos/models"
+)
 
 const (
 	// AlertLvlError represents Bootstrap alert danger
@@ -14,6 +18,8 @@ const (
 	// AlertMsgGeneric is displayed when any random error is encountered on backend
 	AlertMsgGeneric = "Something went wrong. Please try again and" +
 		"contact us if the problem persists."
+	// AlertMsgFields is displayed above a form with invalid fields
+	AlertMsgFields = "Please correct the errors below."
 )
 
 // PublicError is the interface for public error messages
@@ -22,20 +28,56 @@ type PublicError interface {
 	Public() string
 }
 
+// FieldErrors is the interface for errors concerning individual form
+// fields, such as models.ValidationError
+type FieldErrors interface {
+	error
+	// FieldErrors returns a public message for every invalid field,
+	// keyed by form field name
+	FieldErrors() map[string]string
+}
+
 // Data is the top level structure that views expect data to come in from.
 type Data struct {
+	// Alert is shown above the page. If the handler leaves it nil,
+	// View.Render fills in an alert passed on by RedirectAlert.
 	Alert *Alert
+	// User is the signed in user, or nil for anonymous visitors.
+	// It is set by View.Render from the request context.
+	User *models.User
+	// Yield is the page's own data. Forms that failed to submit get
+	// the submitted form back here, without passwords, so they can be
+	// filled in again.
 	Yield interface{}
+	// Errors holds the message for every invalid form field, keyed by
+	// field name. Templates read it with fieldError, e.g.
+	// {{fieldError "email"}}.
+	Errors map[string]string
+	// CSRFField is the hidden input holding the request's CSRF token.
+	// It is set by View.Render and exposed to templates as csrfField.
+	CSRFField template.HTML
+	// CSPNonce is the Content-Security-Policy nonce for this request.
+	// Inline scripts and styles must carry it, via the cspNonce func.
+	CSPNonce string
+
+	// err is the non-public error behind a generic alert. It is logged
+	// by View.Render with the request's logger.
+	err error
 }
 
-// SetAlert sets an error as alert
+// SetAlert sets an error as alert. FieldErrors are shown next to their
+// fields. Errors that are not PublicErrors are shown as a generic
+// message and logged when the view is rendered.
 func (d *Data) SetAlert(err error) {
 	var msg string
 
-	if pErr, ok := err.(PublicError); ok {
+	if fErr, ok := err.(FieldErrors); ok {
+		d.Errors = fErr.FieldErrors()
+		msg = AlertMsgFields
+	} else if pErr, ok := err.(PublicError); ok {
 		msg = pErr.Public()
 	} else {
-		log.Println(err)
+		d.err = err
 		msg = AlertMsgGeneric
 	}
 
@@ -53,6 +95,18 @@ func (d *Data) AlertError(msg string) {
 	}
 }
 
+// AlertFieldError shows msg next to the named form field
+func (d *Data) AlertFieldError(field, msg string) {
+	if d.Errors == nil {
+		d.Errors = map[string]string{}
+	}
+	d.Errors[field] = msg
+	d.Alert = &Alert{
+		Level:   AlertLvlError,
+		Message: AlertMsgFields,
+	}
+}
+
 // Alert is used to render Bootstrap Alert messages in templates.
 type Alert struct {
 	Level   string
@@ -0,0 +1,86 @@
+package views
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errorStatuses are the status codes with a branded error page in
+// views/errors/. Any other status is rendered with the 500 page.
+var errorStatuses = []int{
+	http.StatusForbidden,
+	http.StatusNotFound,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+}
+
+var (
+	errorViews     map[int]*View
+	errorViewsOnce sync.Once
+)
+
+// errorView returns the view for the given status. The views are
+// parsed on first use so importing views has no side effects.
+func errorView(status int) *View {
+	errorViewsOnce.Do(func() {
+		errorViews = make(map[int]*View, len(errorStatuses))
+		for _, s := range errorStatuses {
+			errorViews[s] = NewView("bootstrap", "errors/"+strconv.Itoa(s))
+		}
+	})
+
+	if v, ok := errorViews[status]; ok {
+		return v
+	}
+	return errorViews[http.StatusInternalServerError]
+}
+
+// Error responds with the error page for the given status code. Clients
+// that prefer JSON (e.g. Accept: application/json) get a JSON body:
+//
+//	{"error":{"status":404,"message":"Not Found"}}
+func Error(w http.ResponseWriter, r *http.Request, status int) {
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{
+				"status":  status,
+				"message": http.StatusText(status),
+			},
+		})
+		return
+	}
+
+	errorView(status).render(w, r, status, nil)
+}
+
+// NotFound responds with the 404 error page
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound)
+}
+
+// Forbidden responds with the 403 error page
+func Forbidden(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusForbidden)
+}
+
+// InternalServerError responds with the 500 error page
+func InternalServerError(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusInternalServerError)
+}
+
+// wantsJSON reports whether the request's Accept header lists JSON
+// ahead of HTML.
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	jsonAt := strings.Index(accept, "application/json")
+	if jsonAt < 0 {
+		return false
+	}
+	htmlAt := strings.Index(accept, "text/html")
+	return htmlAt < 0 || jsonAt < htmlAt
+}
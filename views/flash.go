@@ -0,0 +1,103 @@
+package views
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nahuakang/gophotos/hash"
+	"github.com/nahuakang/gophotos/rand"
+)
+
+// flashCookie holds an alert waiting to be shown on the next page,
+// signed so that nobody but the server can plant messages in it:
+//
+//	<base64 JSON alert>.<signature>
+const flashCookie = "alert"
+
+// flashMaxAge is how long a flash waits to be shown before the
+// browser drops it
+const flashMaxAge = 5 * time.Minute
+
+var (
+	flashHMAC   = hash.NewHMAC(mustRandomKey())
+	flashSecure bool
+)
+
+// UseFlashKey sets the key flash cookies are signed with, so that they
+// work across instances and restarts, and whether they are limited to
+// HTTPS. Without it, flashes are signed with a random key that only
+// this process knows.
+func UseFlashKey(key string, secure bool) {
+	// The key may also sign other cookies, so flash signatures get
+	// a prefix of their own
+	flashHMAC = hash.NewHMAC("flash:" + key)
+	flashSecure = secure
+}
+
+// RedirectAlert redirects to urlStr and shows alert on the page the
+// user lands on, or whichever view is rendered for them next.
+func RedirectAlert(w http.ResponseWriter, r *http.Request, urlStr string, code int, alert Alert) {
+	setFlash(w, alert)
+	http.Redirect(w, r, urlStr, code)
+}
+
+func setFlash(w http.ResponseWriter, alert Alert) {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     flashCookie,
+		Value:    payload + "." + flashHMAC.Hash(payload),
+		Path:     "/",
+		MaxAge:   int(flashMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   flashSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// takeFlash returns the pending flash of r, if there is a valid one,
+// and clears the cookie so it is only shown once
+func takeFlash(w http.ResponseWriter, r *http.Request) *Alert {
+	c, err := r.Cookie(flashCookie)
+	if err != nil {
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     flashCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Secure:   flashSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	dot := strings.LastIndexByte(c.Value, '.')
+	if dot < 0 || !flashHMAC.Equal(c.Value[:dot], c.Value[dot+1:]) {
+		return nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(c.Value[:dot])
+	if err != nil {
+		return nil
+	}
+	var alert Alert
+	if err := json.Unmarshal(b, &alert); err != nil || alert.Message == "" {
+		return nil
+	}
+	return &alert
+}
+
+func mustRandomKey() string {
+	key, err := rand.String(32)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
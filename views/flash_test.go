@@ -0,0 +1,164 @@
+package views
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nahuakang/gophotos/hash"
+)
+
+// useTestFlashKey signs flashes with key for the rest of the test
+func useTestFlashKey(t *testing.T, key string) {
+	t.Helper()
+	prevHMAC, prevSecure := flashHMAC, flashSecure
+	t.Cleanup(func() { flashHMAC, flashSecure = prevHMAC, prevSecure })
+	UseFlashKey(key, true)
+}
+
+// redirectFlash returns the flash cookie set by RedirectAlert
+func redirectFlash(t *testing.T, alert Alert) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	RedirectAlert(w, httptest.NewRequest("POST", "/galleries", nil), "/galleries/1", http.StatusFound, alert)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/galleries/1" {
+		t.Fatalf("RedirectAlert() = %d to %q, want a 302 to /galleries/1", w.Code, w.Header().Get("Location"))
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == flashCookie {
+			return c
+		}
+	}
+	t.Fatalf("RedirectAlert() set no %s cookie", flashCookie)
+	return nil
+}
+
+// renderWith renders the home page for a request carrying c and
+// returns the response
+func renderWith(t *testing.T, c *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/galleries/1", nil)
+	if c != nil {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	NewView("bootstrap", "static/home").Render(w, r, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Render() status = %d, want %d", w.Code, http.StatusOK)
+	}
+	return w
+}
+
+// cleared reports whether the response deletes the flash cookie
+func cleared(w *httptest.ResponseRecorder) bool {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == flashCookie && c.Value == "" && c.MaxAge < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFlashRoundTrip(t *testing.T) {
+	useTestFlashKey(t, "test-cookie-key")
+	alert := Alert{Level: AlertLvlSuccess, Message: "Gallery successfully created!"}
+	c := redirectFlash(t, alert)
+	if !c.HttpOnly || !c.Secure || c.MaxAge <= 0 {
+		t.Errorf("flash cookie = %+v, want HttpOnly, Secure and short-lived", c)
+	}
+
+	w := renderWith(t, c)
+	body := w.Body.String()
+	if !strings.Contains(body, alert.Message) || !strings.Contains(body, "alert-"+alert.Level) {
+		t.Errorf("rendered page does not show the %s alert %q", alert.Level, alert.Message)
+	}
+	if !cleared(w) {
+		t.Errorf("rendering the flash did not clear the cookie")
+	}
+
+	// The browser drops the cleared cookie, so the next page has no alert
+	if body := renderWith(t, nil).Body.String(); strings.Contains(body, alert.Message) {
+		t.Errorf("the flash was shown again on the next page")
+	}
+}
+
+func TestFlashHandlerAlertWins(t *testing.T) {
+	useTestFlashKey(t, "test-cookie-key")
+	c := redirectFlash(t, Alert{Level: AlertLvlSuccess, Message: "Gallery successfully created!"})
+
+	r := httptest.NewRequest("GET", "/galleries/1", nil)
+	r.AddCookie(c)
+	w := httptest.NewRecorder()
+	NewView("bootstrap", "static/home").Render(w, r, Data{
+		Alert: &Alert{Level: AlertLvlError, Message: "Title is required"},
+	})
+	body := w.Body.String()
+	if !strings.Contains(body, "Title is required") || strings.Contains(body, "successfully created") {
+		t.Errorf("rendered page does not show only the handler's alert")
+	}
+	if !cleared(w) {
+		t.Errorf("a flash that lost to the handler's alert was not cleared")
+	}
+}
+
+func TestFlashTampered(t *testing.T) {
+	useTestFlashKey(t, "test-cookie-key")
+	valid := redirectFlash(t, Alert{Level: AlertLvlInfo, Message: "Welcome back"}).Value
+	dot := strings.LastIndexByte(valid, '.')
+	payload, sig := valid[:dot], valid[dot+1:]
+
+	forged := base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"Level":"danger","Message":"Your account is locked, call 555-0100"}`))
+	otherKey := hash.NewHMAC("flash:another-key")
+	signed := func(payload string) string { return payload + "." + flashHMAC.Hash(payload) }
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"forged message", forged + "." + sig},
+		{"changed signature", payload + "." + strings.Repeat("A", len(sig))},
+		{"unsigned", payload},
+		{"empty signature", payload + "."},
+		{"signed with another key", payload + "." + otherKey.Hash(payload)},
+		{"signed without the flash prefix", payload + "." + hash.NewHMAC("test-cookie-key").Hash(payload)},
+		{"signed garbage", signed("not base64!")},
+		{"signed non-JSON", signed(base64.RawURLEncoding.EncodeToString([]byte("Welcome back")))},
+		{"signed empty message", signed(base64.RawURLEncoding.EncodeToString([]byte(`{"Level":"info"}`)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := renderWith(t, &http.Cookie{Name: flashCookie, Value: tt.value})
+			body := w.Body.String()
+			if strings.Contains(body, `role="alert"`) {
+				t.Errorf("rendered an alert for an invalid flash cookie")
+			}
+			if !cleared(w) {
+				t.Errorf("the invalid flash cookie was not cleared")
+			}
+		})
+	}
+}
+
+func TestFlashKeyShared(t *testing.T) {
+	// Another instance with the same key can show the flash
+	useTestFlashKey(t, "shared-key")
+	c := redirectFlash(t, Alert{Level: AlertLvlSuccess, Message: "Signed out"})
+	UseFlashKey("shared-key", true)
+	if got := takeFlash(httptest.NewRecorder(), requestWith(c)); got == nil || got.Message != "Signed out" {
+		t.Errorf("takeFlash() with the same key = %+v, want the alert", got)
+	}
+
+	UseFlashKey("rotated-key", true)
+	if got := takeFlash(httptest.NewRecorder(), requestWith(c)); got != nil {
+		t.Errorf("takeFlash() with another key = %+v, want nil", got)
+	}
+}
+
+func requestWith(c *http.Cookie) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+	return r
+}
@@ -2,32 +2,46 @@ package views
 
 import (
 	"bytes"
+	"embed"
+	"errors"
 	"html/template"
 	"io"
+	"io/fs"
 	"net/http"
-	"path/filepath"
+	"os"
+
+	"github.com/gorilla/csrf"
+	"github.com/nahuakang/gophotos/assets"
+	"github.com/nahuakang/gophotos/context"
+	"github.com/nahuakang/gophotos/trace"
+)
+
+//go:embed */*.gohtml
+var embedded embed.FS
+
+// templates is where the template files are parsed from. It is the
+// copy compiled into the binary unless UseDir has been called.
+var (
+	templates fs.FS = embedded
+	reload    bool
 )
 
+// UseDir makes views parse their templates from dir, the views
+// directory of a source checkout, and re-parse them on every render
+// so template changes show up without a restart. It is meant for
+// development and must be called before any view is created.
+func UseDir(dir string) {
+	templates = os.DirFS(dir)
+	reload = true
+}
+
 // LayoutDir is the directory to layouts
 // TemplateExt is the extension name for the files
 var (
-	LayoutDir   = "views/layouts/"
-	TemplateDir = "views/"
+	LayoutDir   = "layouts/"
 	TemplateExt = ".gohtml"
 )
 
-// addTemplatePath takes in a slice of strings
-// representing file paths for templates and prepends
-// the TemplateDir directory to each string in the slice
-//
-// E.g. the input {"home"} would result in the output
-// {"views/home"} if TemplateDir == "views/"
-func addTemplatePath(files []string) {
-	for i, f := range files {
-		files[i] = TemplateDir + f
-	}
-}
-
 // addTemplateExt takes in a slice of strings
 // representing file paths for templates and appends
 // the TemplateExt extension to each string in the slice
@@ -40,17 +54,14 @@ func addTemplateExt(files []string) {
 	}
 }
 
-// NewView automates the logic for views
+// NewView automates the logic for views. files are template names
+// relative to the views directory, without the extension, e.g.
+// "users/new".
 func NewView(layout string, files ...string) *View {
-	addTemplatePath(files)
 	addTemplateExt(files)
+	files = append(files, LayoutDir+"*"+TemplateExt)
 
-	files = append(
-		files,
-		layoutFiles()...,
-	)
-
-	t, err := template.ParseFiles(files...)
+	t, err := parse(files)
 	if err != nil {
 		panic(err)
 	}
@@ -58,52 +69,127 @@ func NewView(layout string, files ...string) *View {
 	return &View{
 		Template: t,
 		Layout:   layout,
+		files:    files,
 	}
 }
 
-// Returns all layout files as a slice of strings
-func layoutFiles() []string {
-	files, err := filepath.Glob(LayoutDir + "*" + TemplateExt)
-	if err != nil {
-		panic(err)
-	}
-	return files
+// parse parses the template files, which may be glob patterns
+func parse(files []string) (*template.Template, error) {
+	// csrfField, cspNonce and fieldError are replaced with
+	// per-request values in Render. The placeholders only exist so
+	// that templates using them can be parsed.
+	return template.New("").Funcs(template.FuncMap{
+		"csrfField": func() (template.HTML, error) {
+			return "", errors.New("csrfField is not implemented")
+		},
+		"cspNonce": func() (string, error) {
+			return "", errors.New("cspNonce is not implemented")
+		},
+		"fieldError": func(string) (string, error) {
+			return "", errors.New("fieldError is not implemented")
+		},
+		"asset": assets.Path,
+	}).ParseFS(templates, files...)
 }
 
 // View is a data structure for html templates
 type View struct {
 	Template *template.Template
 	Layout   string
+	files    []string
 }
 
 // Render renders a view
-func (v *View) Render(w http.ResponseWriter, data interface{}) {
+func (v *View) Render(w http.ResponseWriter, r *http.Request, data interface{}) {
+	v.render(w, r, http.StatusOK, data)
+}
+
+// render renders a view with the given status code. If the template
+// fails to execute, a plain text 500 is sent instead since rendering
+// an error page could fail the same way.
+func (v *View) render(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	_, span := trace.Start(r.Context(), "View.Render", "layout", v.Layout, "status", status)
+	defer span.End()
+
 	w.Header().Set("Content-Type", "text/html")
 
-	switch data.(type) {
+	var vd Data
+	switch d := data.(type) {
 	case Data:
-		// do nothing
+		vd = d
 	default:
 		// Convert data to the Data struct type
-		data = Data{
+		vd = Data{
 			Yield: data,
 		}
 	}
+	lg := context.Logger(r.Context())
+	if vd.err != nil {
+		lg.Error("rendering alert", "error", vd.err)
+	}
+
+	// A pending flash is always cleared, but an alert set by the
+	// handler takes precedence
+	if flash := takeFlash(w, r); flash != nil && vd.Alert == nil {
+		vd.Alert = flash
+	}
+	vd.User = context.User(r.Context())
+	vd.CSRFField = csrf.TemplateField(r)
+	vd.CSPNonce = context.CSPNonce(r.Context())
+
+	tpl, err := v.template()
+	if err != nil {
+		lg.Error("loading template", "error", err)
+		span.RecordError(err)
+		msg := "Something went wrong. If the problem " +
+			"persists, please email support@gophotos.com"
+		if reload {
+			// Only reachable in development, so show what is
+			// wrong with the template
+			msg = err.Error()
+		}
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	tpl = tpl.Funcs(template.FuncMap{
+		"csrfField": func() template.HTML {
+			return vd.CSRFField
+		},
+		"cspNonce": func() string {
+			return vd.CSPNonce
+		},
+		"fieldError": func(field string) string {
+			return vd.Errors[field]
+		},
+	})
 
 	var buf bytes.Buffer
-	err := v.Template.ExecuteTemplate(&buf, v.Layout, data)
+	err = tpl.ExecuteTemplate(&buf, v.Layout, vd)
 	if err != nil {
+		lg.Error("executing template", "layout", v.Layout, "error", err)
+		span.RecordError(err)
 		http.Error(w, "Something went wrong. If the problem "+
 			"persists, please email support@gophotos.com",
 			http.StatusInternalServerError)
 		return
 	}
 
+	w.WriteHeader(status)
 	io.Copy(w, &buf)
 }
 
+// template returns a copy of the view's template that is safe to bind
+// per-request funcs to, so they do not leak into renders for other
+// requests. In development it is parsed again from disk.
+func (v *View) template() (*template.Template, error) {
+	if reload {
+		return parse(v.files)
+	}
+	return v.Template.Clone()
+}
+
 // ServeHTTP ensures views.View implements http.Handler
 // which in turn is taken by mux.Router.Handle()
 func (v *View) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	v.Render(w, nil)
+	v.Render(w, r, nil)
 }